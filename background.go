@@ -0,0 +1,88 @@
+package main
+
+// the cards of a reading can be laid on a colored background,
+// or on a texture (such as felt) tiled across the whole image.
+// Textures are images kept in the textures resource directory,
+// and requested by name without the extension.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// namedColors are the backgrounds that can be asked for by name.
+var namedColors = map[string]color.Color{
+	"transparent": color.Transparent,
+	"black":       color.Black,
+	"white":       color.White,
+	"felt":        color.RGBA{0x1e, 0x5c, 0x34, 0xff},
+	"navy":        backColor,
+}
+
+// parseColor reads a color as a name, or in hex as rgb or rrggbb
+// with an optional leading #.  The empty string is transparent.
+func parseColor(s string) (color.Color, error) {
+	if s == "" {
+		return color.Transparent, nil
+	}
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+		}
+	}
+	return nil, fmt.Errorf("bad color %q", s)
+}
+
+// loadTexture finds the named texture among the resources,
+// and decodes it.
+func loadTexture(name string) (image.Image, error) {
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return nil, fmt.Errorf("bad texture %q", name)
+	}
+	dir, err := rscBase.Path("textures")
+	if err != nil {
+		return nil, err
+	}
+	for _, suffix := range imageSuffixes {
+		f, err := os.Open(filepath.Join(dir, name+suffix))
+		if err != nil {
+			continue
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("texture %s: %v", name, err)
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("no texture named %q", name)
+}
+
+// a tiledImage repeats its tile in every direction.
+type tiledImage struct {
+	tile image.Image
+}
+
+func (ti *tiledImage) ColorModel() color.Model { return ti.tile.ColorModel() }
+func (ti *tiledImage) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+func (ti *tiledImage) At(x, y int) color.Color {
+	b := ti.tile.Bounds()
+	x = ((x-b.Min.X)%b.Dx()+b.Dx())%b.Dx() + b.Min.X
+	y = ((y-b.Min.Y)%b.Dy()+b.Dy())%b.Dy() + b.Min.Y
+	return ti.tile.At(x, y)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"net/url"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s    string
+		want color.Color // nil when it fails
+	}{
+		{"", color.Transparent},
+		{"transparent", color.Transparent},
+		{"Black", color.Black},
+		{"FELT", color.RGBA{0x1e, 0x5c, 0x34, 0xff}},
+		{"#ff8000", color.RGBA{0xff, 0x80, 0x00, 0xff}},
+		{"FF8000", color.RGBA{0xff, 0x80, 0x00, 0xff}},
+		{"#f80", color.RGBA{0xff, 0x88, 0x00, 0xff}},
+		{"1a2", color.RGBA{0x11, 0xaa, 0x22, 0xff}},
+		{"#ff80", nil},
+		{"#ff800000", nil},
+		{"#gg8000", nil},
+		{"+12345", nil},
+		{"chartreuse", nil},
+		{"#", nil},
+	}
+	for _, tt := range tests {
+		c, err := parseColor(tt.s)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseColor(%q) = %v, want an error", tt.s, c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseColor(%q): %v", tt.s, err)
+			continue
+		}
+		r, g, b, a := c.RGBA()
+		wr, wg, wb, wa := tt.want.RGBA()
+		if r != wr || g != wg || b != wb || a != wa {
+			t.Errorf("parseColor(%q) = %v, want %v", tt.s, c, tt.want)
+		}
+	}
+}
+
+func TestPixelParam(t *testing.T) {
+	tests := []struct {
+		query string
+		n     int
+		fails bool
+	}{
+		{"", 0, false},
+		{"margin=", 0, false},
+		{"margin=12", 12, false},
+		{"margin=0", 0, false},
+		{"margin=-4", 0, true},
+		{"margin=1.5", 0, true},
+		{"margin=wide", 0, true},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		n, err := pixelParam(params, "margin")
+		if (err != nil) != tt.fails || n != tt.n {
+			t.Errorf("pixelParam(%q) = %d, %v; want %d, failing %v", tt.query, n, err, tt.n, tt.fails)
+		}
+	}
+}
+
+func TestTiledImage(t *testing.T) {
+	tile := image.NewGray(image.Rect(2, 3, 5, 5))
+	for idx := range tile.Pix {
+		tile.Pix[idx] = uint8(idx)
+	}
+	ti := &tiledImage{tile}
+	tests := []struct {
+		x, y int
+		at   image.Point // where in the tile that lands
+	}{
+		{2, 3, image.Pt(2, 3)},
+		{4, 4, image.Pt(4, 4)},
+		{5, 3, image.Pt(2, 3)},
+		{0, 0, image.Pt(3, 4)},
+		{-1, -1, image.Pt(2, 3)},
+		{-7, 10, image.Pt(2, 4)},
+	}
+	for _, tt := range tests {
+		if got, want := ti.At(tt.x, tt.y), tile.At(tt.at.X, tt.at.Y); got != want {
+			t.Errorf("tile at %d,%d is %v, want %v from %v", tt.x, tt.y, got, want, tt.at)
+		}
+	}
+}
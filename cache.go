@@ -1,15 +1,72 @@
 package main
 
-// a simple cache so we don't keep reloading the same deck
+// a simple LRU cache so we don't keep reloading the same decks.
+// The cache holds its own reference to every deck in it, and
+// gives that reference up when the deck is evicted, so a deck
+// that's still in use stays open until its last user Closes it.
 
-import "sync"
+import (
+	"container/list"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
 
 const (
-	safeDeck = "Poker.zip" // part of the distribution
+	safeDeck = "Poker" // part of the distribution
 )
 
+// deckSuffixes are tried in order when looking up a deck by
+// name; the empty suffix finds a directory of images.
+var deckSuffixes = []string{".zip", ".tar", ""}
+
+// shortDeckName gives the name of the deck at fn, as the
+// user would request it.
+func shortDeckName(fn string) string {
+	base := filepath.Base(fn)
+	for _, suffix := range deckSuffixes {
+		if suffix != "" && strings.EqualFold(filepath.Ext(base), suffix) {
+			return base[:len(base)-len(suffix)]
+		}
+	}
+	return base
+}
+
+// otherDirs are resource directories that hold something other
+// than a deck, so they are never taken for directory decks.
+var otherDirs = map[string]bool{"spreads": true, "textures": true}
+
+// findDeck locates the named deck among the resources.  The name
+// has to be a plain file name, so that a request can't reach
+// outside of the resource directories.
+func findDeck(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") ||
+		strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("bad deck name %q", name)
+	}
+	err := fmt.Errorf("no deck named %q", name)
+	for _, suffix := range deckSuffixes {
+		if suffix == "" && otherDirs[strings.ToLower(name)] {
+			continue
+		}
+		var fullname string
+		if fullname, err = rscBase.Path(name + suffix); err == nil {
+			return fullname, nil
+		}
+	}
+	return "", err
+}
+
+type cacheEntry struct {
+	dk       *deck
+	lastUsed time.Time
+}
+
 var cacheLock sync.Mutex
-var latest *deck
+var cacheOrder = list.New() // most recently used at the front
+var cacheIndex = make(map[string]*list.Element)
 
 func requestDeck(name string) (*deck, error) {
 	var (
@@ -17,31 +74,26 @@ func requestDeck(name string) (*deck, error) {
 		err    error
 	)
 
-	fullname, err := rscBase.Path(name)
+	fullname, err := findDeck(name)
 	if err != nil {
 		return nil, err
 	}
 
 	cacheLock.Lock()
 
-	// is it already our latest deck?  If so, return it.
-	if latest != nil {
-		if latest.name == fullname {
-			// the cached deck matches; return it
-			answer = latest
-		} else {
-			// it didn't match, clear it out
-			latest.Close()
-			latest = nil
-		}
-	}
-
-	if answer == nil {
+	// is it already in the cache?  If so, use it.
+	if elem, ok := cacheIndex[fullname]; ok {
+		ent := elem.Value.(*cacheEntry)
+		ent.lastUsed = time.Now()
+		cacheOrder.MoveToFront(elem)
+		answer = ent.dk
+	} else {
 		// it wasn't in the cache, so look up the deck
-		latest, err = newDeck(fullname)
+		answer, err = newDeck(fullname)
 		if err == nil {
-			latest.Open()
-			answer = latest
+			answer.Open()
+			cacheIndex[fullname] = cacheOrder.PushFront(&cacheEntry{answer, time.Now()})
+			trimCache(*deckCacheSize)
 		}
 	}
 
@@ -62,3 +114,44 @@ func requestDeck(name string) (*deck, error) {
 
 	return answer, err
 }
+
+// evict removes a cache element, and releases the cache's
+// reference to the deck.  The cacheLock must be held.
+func evict(elem *list.Element) {
+	ent := cacheOrder.Remove(elem).(*cacheEntry)
+	delete(cacheIndex, ent.dk.Name())
+	ent.dk.Close()
+}
+
+// trimCache evicts the least recently used decks until no
+// more than size remain.  The cacheLock must be held.
+func trimCache(size int) {
+	if size < 1 {
+		size = 1
+	}
+	for cacheOrder.Len() > size {
+		evict(cacheOrder.Back())
+	}
+}
+
+// evictIdle releases every deck that hasn't been requested
+// since the cutoff.  Since the least recently used decks are
+// at the back, we can stop at the first one still in use.
+func evictIdle(cutoff time.Time) {
+	cacheLock.Lock()
+	for elem := cacheOrder.Back(); elem != nil; elem = cacheOrder.Back() {
+		if !elem.Value.(*cacheEntry).lastUsed.Before(cutoff) {
+			break
+		}
+		evict(elem)
+	}
+	cacheLock.Unlock()
+}
+
+// sweepIdleDecks runs forever, periodically evicting decks
+// that have gone unused for the idle duration.
+func sweepIdleDecks(idle time.Duration) {
+	for range time.Tick(idle / 2) {
+		evictIdle(time.Now().Add(-idle))
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"container/list"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rwtodd/Go.AppUtil/resource"
+)
+
+func TestFindDeckRejects(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "../examples", "../../..", "a/b", `a\b`, ".hidden", "x..y"} {
+		if fn, err := findDeck(name); err == nil {
+			t.Errorf("findDeck(%q) = %q, want an error", name, fn)
+		}
+	}
+}
+
+// a countingStore is a card store that counts its closes.
+type countingStore struct{ closes int }
+
+func (cs *countingStore) Files() []storeFile { return nil }
+func (cs *countingStore) Close() error       { cs.closes++; return nil }
+
+// testCache empties the deck cache, and puts the resources in a
+// fresh directory with an (empty) directory deck for each of the
+// names.  It gives back the directory, and a function to put
+// everything back afterward.
+func testCache(t *testing.T, names ...string) (string, func()) {
+	dir, err := ioutil.TempDir("", "carddiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldBase, oldOrder, oldIndex, oldSize := rscBase, cacheOrder, cacheIndex, *deckCacheSize
+	rscBase = resource.NewPathLocator([]string{dir}, "")
+	cacheOrder, cacheIndex = list.New(), make(map[string]*list.Element)
+	return dir, func() {
+		rscBase, cacheOrder, cacheIndex, *deckCacheSize = oldBase, oldOrder, oldIndex, oldSize
+		os.RemoveAll(dir)
+	}
+}
+
+// cacheStub puts a stand-in for the named deck at the front of
+// the cache, holding the cache's reference to it.
+func cacheStub(dir, name string, lastUsed time.Time) *deck {
+	fullname := filepath.Join(dir, name)
+	dk := &deck{name: fullname, store: &countingStore{}}
+	dk.Open()
+	cacheIndex[fullname] = cacheOrder.PushFront(&cacheEntry{dk, lastUsed})
+	return dk
+}
+
+// cached lists the decks in the cache, most recently used first.
+func cached() string {
+	var answer []string
+	for elem := cacheOrder.Front(); elem != nil; elem = elem.Next() {
+		answer = append(answer, filepath.Base(elem.Value.(*cacheEntry).dk.Name()))
+	}
+	return strings.Join(answer, " ")
+}
+
+// closes tells how many times the stub deck's store was closed.
+func closes(dk *deck) int { return dk.store.(*countingStore).closes }
+
+func TestRequestDeck(t *testing.T) {
+	dir, restore := testCache(t, "A", "B", "C")
+	defer restore()
+	a := cacheStub(dir, "A", time.Now())
+	b := cacheStub(dir, "B", time.Now())
+	cacheStub(dir, "C", time.Now())
+
+	// a deck in the cache moves to the front, and gets another
+	// reference for the caller
+	dk, err := requestDeck("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dk != a || a.refcnt != 2 || cached() != "A C B" {
+		t.Errorf("requesting A gave %s with %d references, leaving %s", dk.Name(), a.refcnt, cached())
+	}
+	dk.Close()
+	if a.refcnt != 1 || closes(a) != 0 {
+		t.Errorf("closing A left %d references, and %d closes", a.refcnt, closes(a))
+	}
+
+	// a deck that isn't cached is read in at the front, and the
+	// least recently used one goes, closed since no one holds it
+	if err := os.Mkdir(filepath.Join(dir, "D"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "D", "card.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 7, 10)))
+	f.Close()
+
+	*deckCacheSize = 3
+	d, err := requestDeck("D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.refcnt != 2 || cached() != "D A C" {
+		t.Errorf("requesting D gave %d references, leaving %s", d.refcnt, cached())
+	}
+	if b.refcnt != 0 || closes(b) != 1 {
+		t.Errorf("evicting B left %d references, and %d closes", b.refcnt, closes(b))
+	}
+}
+
+func TestTrimCache(t *testing.T) {
+	dir, restore := testCache(t)
+	defer restore()
+	a := cacheStub(dir, "A", time.Now())
+	b := cacheStub(dir, "B", time.Now())
+	c := cacheStub(dir, "C", time.Now())
+
+	// A is still being drawn from when it's evicted
+	a.Open()
+	trimCache(1)
+	if cached() != "C" || len(cacheIndex) != 1 {
+		t.Errorf("trimming to one deck left %s, with %d indexed", cached(), len(cacheIndex))
+	}
+	if a.refcnt != 1 || closes(a) != 0 {
+		t.Errorf("evicting A, still in use, left %d references, and %d closes", a.refcnt, closes(a))
+	}
+	if b.refcnt != 0 || closes(b) != 1 {
+		t.Errorf("evicting B left %d references, and %d closes", b.refcnt, closes(b))
+	}
+	if c.refcnt != 1 || closes(c) != 0 {
+		t.Errorf("keeping C left %d references, and %d closes", c.refcnt, closes(c))
+	}
+
+	// it closes when its last user is done with it
+	a.Close()
+	if a.refcnt != 0 || closes(a) != 1 {
+		t.Errorf("closing A left %d references, and %d closes", a.refcnt, closes(a))
+	}
+
+	// the cache always keeps at least one deck
+	trimCache(0)
+	if cached() != "C" {
+		t.Errorf("trimming to no decks left %s", cached())
+	}
+}
+
+func TestEvictIdle(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		idle   []int // minutes since each deck was used, least recent first
+		cutoff int   // in minutes ago
+		left   string
+	}{
+		{[]int{3, 2, 1}, 0, ""},
+		{[]int{3, 2, 1}, 2, "C"},
+		{[]int{3, 2, 1}, 4, "C B A"},
+		// the sweep stops at the first deck still in use
+		{[]int{3, 1, 2}, 2, "C B"},
+	}
+	for _, tt := range tests {
+		dir, restore := testCache(t)
+		var decks []*deck
+		for idx, ago := range tt.idle {
+			decks = append(decks, cacheStub(dir, string(rune('A'+idx)), now.Add(-time.Duration(ago)*time.Minute)))
+		}
+		evictIdle(now.Add(-time.Duration(tt.cutoff)*time.Minute + time.Second))
+		if got := cached(); got != tt.left {
+			t.Errorf("evicting idle decks %v at %d left %q, want %q", tt.idle, tt.cutoff, got, tt.left)
+		}
+		for _, dk := range decks {
+			want := 1
+			if _, kept := cacheIndex[dk.Name()]; kept {
+				want = 0
+			}
+			if closes(dk) != want {
+				t.Errorf("evicting idle decks %v at %d closed %s %d times, want %d",
+					tt.idle, tt.cutoff, filepath.Base(dk.Name()), closes(dk), want)
+			}
+		}
+		restore()
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+// a catalog of the decks available in the resource directories
+// (archives and directories of images),
+// so the UI can offer a list rather than making the user
+// remember deck names.
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type deckSummary struct {
+	Name        string  `json:"name"`
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	Cards       int     `json:"cards"`
+	Ratio       float64 `json:"ratio"`
+}
+
+var catalogLock sync.Mutex
+var catalog []deckSummary
+
+// deckDirs gives the directories the resource locator
+// searches, in order.
+func deckDirs() []string {
+	dirs := append([]string{}, rscPaths...)
+	for _, gp := range filepath.SplitList(os.Getenv("GOPATH")) {
+		dirs = append(dirs, filepath.Join(gp, "src", rscSub))
+	}
+	return dirs
+}
+
+// scanDecks rebuilds the catalog from every deck found in the
+// resource directories.  When a name appears more than once,
+// the catalog describes the one requestDeck would find.
+func scanDecks() {
+	seen := make(map[string]bool)
+	found := []deckSummary{}
+
+	for _, dir := range deckDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, ent := range entries {
+			name := shortDeckName(ent.Name())
+			isArchive := name != ent.Name()
+			if seen[name] || strings.HasPrefix(name, ".") ||
+				!(ent.IsDir() || isArchive) {
+				continue
+			}
+			fn, err := findDeck(name)
+			if err != nil {
+				continue
+			}
+
+			// plenty of directories aren't decks, so only
+			// complain about the ones that have images
+			dk, err := newDeck(fn)
+			if err != nil {
+				if err != errNoImages {
+					log.Printf("skipping deck %s: %v", fn, err)
+				}
+				continue
+			}
+			seen[name] = true
+			found = append(found, deckSummary{
+				Name:        name,
+				Title:       dk.Title(),
+				Description: dk.Description(),
+				Cards:       dk.NumCards(),
+				Ratio:       dk.Ratio(),
+			})
+
+			// take and release a reference, which closes the deck
+			dk.Open()
+			dk.Close()
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+
+	catalogLock.Lock()
+	catalog = found
+	catalogLock.Unlock()
+}
+
+// deckCatalog gives the most recently scanned list of decks.
+func deckCatalog() []deckSummary {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	return catalog
+}
@@ -3,17 +3,14 @@ package main
 // configuration to send to the HTML/JS portion of the
 // app, which keeps all the logic needed to add another
 // layout in the Go part, unless new parameters need
-// to be added.
+// to be added.  Layouts are described here as they are
+// registered, so spread files show up automatically.
 
 type cardConfig struct {
-	ID      string
-	Display string
-	Params  []string
+	ID        string
+	Display   string
+	Params    []string
+	Positions []string `json:",omitempty"` // when known in advance
 }
 
-var configurations = []cardConfig{
-	{"/carddiv/row/", "Row of Cards", []string{"cards", "pct"}},
-	{"/carddiv/celtic/", "Celtic Cross", []string{}},
-	{"/carddiv/houses/", "12 Astrological Houses", []string{}},
-	{"/carddiv/tableau/", "Grand Tableau", []string{}},
-}
+var configurations []cardConfig
@@ -1,85 +1,232 @@
 package main
 
 import (
-	"archive/zip"
+	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
+	"io"
 	"math/rand"
+	"path"
+	"sort"
 	"strings"
 	"sync"
+)
+
+// the image formats card scans may use
+import (
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 
-	"github.com/nfnt/resize"
+	_ "golang.org/x/image/webp"
 )
 
 // representation for our card deck...
 
+// imageSuffixes are the files we take to be card images.  The
+// images are decoded through the image package's registry, so
+// each of these needs its format imported.
+var imageSuffixes = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+func isImageFile(name string) bool {
+	lowName := strings.ToLower(name)
+	for _, suffix := range imageSuffixes {
+		if strings.HasSuffix(lowName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 type deck struct {
 	name  string
-	zfile *zip.ReadCloser
-	imgs  []*zip.File
+	title string
+	desc  string
+	store cardStore
+	imgs  []storeFile
+	cards []cardInfo
+	sizes []image.Point
 	ratio float64
 
+	// the card back is kept apart from the cards, so
+	// it never turns up in a shuffle
+	back     storeFile
+	backSize image.Point
+
 	// these two fields manage the resources
 	// owned by the deck
 	refcnt uint32
 	lock   sync.Mutex
 }
 
+var errNoImages = errors.New("newdeck: No images in the deck")
+
+// newDeck opens a deck from a zip file, a tar file, or a
+// directory of images.
 func newDeck(fn string) (*deck, error) {
-	zfile, err := zip.OpenReader(fn)
+	store, err := openStore(fn)
 	if err != nil {
 		return nil, err
 	}
 
-	// filter the files down to the JPG files...
-	imgs := make([]*zip.File, 0, len(zfile.File))
-	for _, v := range zfile.File {
-		lowName := strings.ToLower(v.FileInfo().Name())
-		if v.FileInfo().Mode().IsRegular() &&
-			(strings.HasSuffix(lowName, ".jpg") ||
-				strings.HasSuffix(lowName, ".jpeg")) {
+	// filter the files down to the images...
+	// and look for a manifest while we are at it
+	var mf *manifest
+	files := store.Files()
+	imgs := make([]storeFile, 0, len(files))
+	for _, v := range files {
+		if isImageFile(path.Base(v.Name())) {
 			imgs = append(imgs, v)
+		} else if mf == nil && isManifest(v) {
+			if mf, err = readManifest(v); err != nil {
+				store.Close()
+				return nil, fmt.Errorf("newdeck: %s: %v", v.Name(), err)
+			}
 		}
 	}
 
-	// now grab the aspect ratio of the files...
-	// assuming that one of them is as good as any other...
+	// without a manifest, the deck is in stored order
+	if mf == nil {
+		mf = &manifest{}
+	}
+	var back storeFile
+	if idx := mf.findBack(imgs); idx >= 0 {
+		back = imgs[idx]
+		imgs = append(imgs[:idx:idx], imgs[idx+1:]...)
+	}
+	imgs, cards := mf.arrange(imgs)
+	title := mf.Title
+	if title == "" {
+		title = shortDeckName(fn)
+	}
+
+	// now measure the cards, and settle on an aspect
+	// ratio for the deck as a whole
 	if len(imgs) < 1 {
-		return nil, fmt.Errorf("newdeck: No images in the zip file")
+		store.Close()
+		return nil, errNoImages
 	}
-	rat, err := determineRatio(imgs[0])
+	sizes, rat, err := measureCards(imgs)
 	if err != nil {
+		store.Close()
 		return nil, err
 	}
 
+	var backSize image.Point
+	if back != nil {
+		if cfg, err := imageConfig(back); err == nil {
+			backSize = image.Pt(cfg.Width, cfg.Height)
+		}
+	}
+
 	// all is well, give back the deck..
 	return &deck{
 		name:  fn,
-		zfile: zfile,
+		title: title,
+		desc:  mf.Description,
+		store: store,
 		imgs:  imgs,
-		ratio: rat}, nil
+		cards: cards,
+		sizes: sizes,
+		ratio: rat,
+
+		back:     back,
+		backSize: backSize}, nil
 }
 
-func determineRatio(zimg *zip.File) (float64, error) {
-	img, err := zimg.Open()
-	if err != nil {
-		return 0.0, err
+// measureCards finds the size of each card image, and the
+// median aspect ratio among them.  Cards that can't be read
+// are left out, and will fail again when they are drawn.
+func measureCards(imgs []storeFile) ([]image.Point, float64, error) {
+	sizes := make([]image.Point, len(imgs))
+	ratios := make([]float64, 0, len(imgs))
+	var err error
+	for idx, sf := range imgs {
+		var cfg image.Config
+		if cfg, err = imageConfig(sf); err != nil || cfg.Width == 0 || cfg.Height == 0 {
+			continue
+		}
+		sizes[idx] = image.Pt(cfg.Width, cfg.Height)
+		ratios = append(ratios, float64(cfg.Width)/float64(cfg.Height))
 	}
-	defer img.Close()
+	if len(ratios) == 0 {
+		if err == nil {
+			err = errNoImages
+		}
+		return nil, 0.0, err
+	}
+
+	sort.Float64s(ratios)
+	return sizes, ratios[len(ratios)/2], nil
+}
 
-	dec, err := jpeg.Decode(img)
+func imageConfig(sf storeFile) (image.Config, error) {
+	img, err := sf.Open()
 	if err != nil {
-		return 0.0, err
+		return image.Config{}, err
 	}
-	b := dec.Bounds()
-	return (float64(b.Dx()) / float64(b.Dy())), nil
+	defer img.Close()
+
+	cfg, _, err := image.DecodeConfig(img)
+	return cfg, err
 }
 
 func (dk *deck) Name() string { return dk.name }
 
 func (dk *deck) NumCards() int { return len(dk.imgs) }
 
+// Title gives the name of the deck from its manifest, or else
+// the name of its file.
+func (dk *deck) Title() string { return dk.title }
+
+// Description gives the description from the deck's manifest,
+// if any.
+func (dk *deck) Description() string { return dk.desc }
+
+// Ratio gives the aspect ratio (width / height) of the cards.
+// It is the median of the cards' ratios, so a few odd-shaped
+// images in the deck don't throw it off.
+func (dk *deck) Ratio() float64 { return dk.ratio }
+
+// backCard can be given in place of a card index, to ask
+// for the card back instead.
+const backCard = -1
+
+// HasBack tells if the deck has an image for the card back.
+func (dk *deck) HasBack() bool { return dk.back != nil }
+
+// file gives the image file for a card, or the card back.
+func (dk *deck) file(which int) (storeFile, error) {
+	switch {
+	case which == backCard && dk.back != nil:
+		return dk.back, nil
+	case which == backCard:
+		return nil, fmt.Errorf("the deck has no card back")
+	case which < 0 || which >= len(dk.imgs):
+		return nil, fmt.Errorf("%d is outside the %d images in deck", which, len(dk.imgs))
+	}
+	return dk.imgs[which], nil
+}
+
+// CardFile gives the name of the image file for a card.
+func (dk *deck) CardFile(which int) string { return dk.imgs[which].Name() }
+
+// Card describes a card, as given in the deck's manifest.  Cards
+// the manifest doesn't cover are just named after their files.
+func (dk *deck) Card(which int) cardInfo { return dk.cards[which] }
+
+// CardName gives the name of a card.
+func (dk *deck) CardName(which int) string { return dk.cards[which].Name }
+
+// Meaning gives the meaning of a card in the given orientation,
+// if the manifest provides one.
+func (dk *deck) Meaning(which int, reversed bool) string {
+	if reversed {
+		return dk.cards[which].Reversed
+	}
+	return dk.cards[which].Upright
+}
+
 func (dk *deck) CardHeight(width int) int { return int(float64(width) / dk.ratio) }
 
 // grab a fresh reference to the deck
@@ -90,45 +237,76 @@ func (dk *deck) Open() {
 }
 
 // release our reference to the deck, closing
-// the zip file if this is our last reference
+// its storage if this is our last reference
 func (dk *deck) Close() error {
 	var err error
 	dk.lock.Lock()
 	if dk.refcnt == 1 {
-		err = dk.zfile.Close()
+		err = dk.store.Close()
 	}
 	dk.refcnt--
 	dk.lock.Unlock()
 	return err
 }
 
+// CardData gives the raw contents of a card's image file.
+func (dk *deck) CardData(which int) ([]byte, error) {
+	sf, err := dk.file(which)
+	if err != nil {
+		return nil, err
+	}
+
+	dk.lock.Lock()
+	defer dk.lock.Unlock()
+
+	img, err := sf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+	return io.ReadAll(img)
+}
+
+// CardSize gives the size of the card's image, or zero if
+// the image couldn't be read.
+func (dk *deck) CardSize(which int) image.Point {
+	if which == backCard {
+		return dk.backSize
+	}
+	return dk.sizes[which]
+}
+
 type cardOpts struct {
 	reversed bool
 	onSide   bool
+	fit      fitMode
 }
 
+// Image gives a card (or the card back) resized to the given width,
+// and turned as requested.
 func (dk *deck) Image(which int, width int, options cardOpts) (image.Image, error) {
-	if which > len(dk.imgs) {
-		return nil, fmt.Errorf("%d is greater than %d images in deck", which, len(dk.imgs))
+	sf, err := dk.file(which)
+	if err != nil {
+		return nil, err
 	}
 
 	dk.lock.Lock()
 	defer dk.lock.Unlock()
 
-	img, err := dk.imgs[which].Open()
+	img, err := sf.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer img.Close()
 
 	var cardImg image.Image
-	cardImg, err = jpeg.Decode(img)
+	cardImg, _, err = image.Decode(img)
 	if err != nil {
 		return nil, err
 	}
 
 	// resize image ...
-	cardImg = resize.Resize(uint(width), uint(dk.CardHeight(width)), cardImg, resize.Bicubic)
+	cardImg = options.fit.fitImage(cardImg, image.Pt(width, dk.CardHeight(width)))
 
 	// possibly rotate the image...
 	if options.reversed {
@@ -142,11 +320,29 @@ func (dk *deck) Image(which int, width int, options cardOpts) (image.Image, erro
 	return cardImg, nil
 }
 
-func (dk *deck) Shuffled(howMany int) ([]int, error) {
+// Shuffled picks howMany random cards from the deck, using the
+// given source of randomness.  Any cards given as exceptions are
+// left out.
+func (dk *deck) Shuffled(rng *rand.Rand, howMany int, except ...int) ([]int, error) {
 	dsize := len(dk.imgs)
-	if howMany > dsize {
+	if howMany > dsize-len(except) {
 		return nil, fmt.Errorf("Not enough cards in deck to get %d", howMany)
 	}
-	shuffled := rand.Perm(dsize)
-	return shuffled[:howMany], nil
+	shuffled := rng.Perm(dsize)
+	answer := shuffled[:0]
+	for _, card := range shuffled {
+		if !containsInt(except, card) {
+			answer = append(answer, card)
+		}
+	}
+	return answer[:howMany], nil
+}
+
+func containsInt(lst []int, n int) bool {
+	for _, v := range lst {
+		if v == n {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// a memFile is a card store file held in memory.
+type memFile struct {
+	name string
+	data []byte
+}
+
+func (mf memFile) Name() string { return mf.name }
+func (mf memFile) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(mf.data)), nil
+}
+
+// testDeck makes a deck of n cards, named "Card 0" and so on, with
+// the proportions of a poker card.  There are no images to draw,
+// but it will shuffle and deal.
+func testDeck(n int) *deck {
+	dk := &deck{name: "Test.zip", title: "Test", ratio: 0.7}
+	for idx := 0; idx < n; idx++ {
+		fn := fmt.Sprintf("card%02d.png", idx)
+		dk.imgs = append(dk.imgs, memFile{name: fn})
+		dk.cards = append(dk.cards, cardInfo{File: fn, Name: fmt.Sprintf("Card %d", idx)})
+	}
+	return dk
+}
+
+func TestShuffled(t *testing.T) {
+	tests := []struct {
+		size, howMany int
+		except        []int
+		fails         bool
+	}{
+		{10, 10, nil, false},
+		{10, 3, nil, false},
+		{10, 9, []int{4}, false},
+		{10, 5, []int{0, 9}, false},
+		{10, 10, []int{4}, true},
+		{10, 11, nil, true},
+		{0, 0, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := testDeck(tt.size).Shuffled(rand.New(rand.NewSource(1)), tt.howMany, tt.except...)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("Shuffled(%d of %d, except %v) = %v, want an error", tt.howMany, tt.size, tt.except, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Shuffled(%d of %d, except %v): %v", tt.howMany, tt.size, tt.except, err)
+			continue
+		}
+		if len(got) != tt.howMany {
+			t.Errorf("Shuffled(%d of %d) gave %d cards", tt.howMany, tt.size, len(got))
+		}
+		seen := make(map[int]bool)
+		for _, card := range got {
+			if card < 0 || card >= tt.size || seen[card] || containsInt(tt.except, card) {
+				t.Errorf("Shuffled(%d of %d, except %v) = %v, with a bad card %d",
+					tt.howMany, tt.size, tt.except, got, card)
+			}
+			seen[card] = true
+		}
+	}
+}
+
+// the same seed has to give the same cards, so that readings can
+// be drawn again; this pins the order down for one seed.
+func TestShuffledSeed(t *testing.T) {
+	dk := testDeck(10)
+	first, _ := dk.Shuffled(rand.New(rand.NewSource(42)), 5)
+	again, _ := dk.Shuffled(rand.New(rand.NewSource(42)), 5)
+	if fmt.Sprint(first) != fmt.Sprint(again) {
+		t.Errorf("seed 42 gave %v, then %v", first, again)
+	}
+	if got, want := fmt.Sprint(first), "[7 5 8 9 2]"; got != want {
+		t.Errorf("seed 42 gave %v, want %v", got, want)
+	}
+
+	// leaving a card out doesn't disturb the order of the rest
+	except, _ := dk.Shuffled(rand.New(rand.NewSource(42)), 5, 8)
+	if got, want := fmt.Sprint(except), "[7 5 9 2 1]"; got != want {
+		t.Errorf("seed 42 without card 8 gave %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// card scans don't always share the deck's aspect ratio, so
+// each card is fit into its slot in one of three ways.
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+type fitMode int
+
+const (
+	fitCrop      fitMode = iota // fill the slot, trimming the edges
+	fitLetterbox                // show the whole card, leaving a margin
+	fitStretch                  // fill the slot, distorting the card
+)
+
+func parseFit(s string) (fitMode, error) {
+	switch strings.ToLower(s) {
+	case "", "crop":
+		return fitCrop, nil
+	case "letterbox":
+		return fitLetterbox, nil
+	case "stretch":
+		return fitStretch, nil
+	}
+	return fitCrop, fmt.Errorf("unknown fit %q", s)
+}
+
+// fitScale gives the factors to scale a card of size src in each
+// direction, to fit it into a slot of size dst.
+func (fm fitMode) fitScale(srcW, srcH, dstW, dstH float64) (float64, float64) {
+	sx, sy := dstW/srcW, dstH/srcH
+	switch fm {
+	case fitCrop:
+		sx = math.Max(sx, sy)
+		sy = sx
+	case fitLetterbox:
+		sx = math.Min(sx, sy)
+		sy = sx
+	}
+	return sx, sy
+}
+
+// fitImage resizes the image to exactly the given size, centered,
+// cropping or letterboxing as needed.
+func (fm fitMode) fitImage(img image.Image, size image.Point) image.Image {
+	b := img.Bounds()
+	sx, sy := fm.fitScale(float64(b.Dx()), float64(b.Dy()), float64(size.X), float64(size.Y))
+	scaled := image.Pt(int(math.Round(float64(b.Dx())*sx)), int(math.Round(float64(b.Dy())*sy)))
+	if scaled == size {
+		return resize.Resize(uint(size.X), uint(size.Y), img, resize.Bicubic)
+	}
+
+	resized := resize.Resize(uint(scaled.X), uint(scaled.Y), img, resize.Bicubic)
+	answer := image.NewRGBA(image.Rectangle{image.ZP, size})
+	offset := size.Sub(scaled).Div(2)
+	draw.Draw(answer, image.Rectangle{offset, offset.Add(scaled)}, resized, resized.Bounds().Min, draw.Src)
+	return answer
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestParseFit(t *testing.T) {
+	tests := []struct {
+		s     string
+		fit   fitMode
+		fails bool
+	}{
+		{"", fitCrop, false},
+		{"crop", fitCrop, false},
+		{"Letterbox", fitLetterbox, false},
+		{"STRETCH", fitStretch, false},
+		{"squash", fitCrop, true},
+	}
+	for _, tt := range tests {
+		fit, err := parseFit(tt.s)
+		if (err != nil) != tt.fails || fit != tt.fit {
+			t.Errorf("parseFit(%q) = %v, %v; want %v, failing %v", tt.s, fit, err, tt.fit, tt.fails)
+		}
+	}
+}
+
+func TestFitScale(t *testing.T) {
+	tests := []struct {
+		fit                    fitMode
+		srcW, srcH, dstW, dstH float64
+		sx, sy                 float64
+	}{
+		// a card the same shape scales the same every way
+		{fitCrop, 100, 200, 50, 100, 0.5, 0.5},
+		{fitLetterbox, 100, 200, 50, 100, 0.5, 0.5},
+		{fitStretch, 100, 200, 50, 100, 0.5, 0.5},
+		// a card too wide for its slot
+		{fitCrop, 200, 200, 50, 100, 0.5, 0.5},
+		{fitLetterbox, 200, 200, 50, 100, 0.25, 0.25},
+		{fitStretch, 200, 200, 50, 100, 0.25, 0.5},
+		// a card too tall, and enlarged
+		{fitCrop, 10, 40, 50, 100, 5, 5},
+		{fitLetterbox, 10, 40, 50, 100, 2.5, 2.5},
+		{fitStretch, 10, 40, 50, 100, 5, 2.5},
+	}
+	for _, tt := range tests {
+		sx, sy := tt.fit.fitScale(tt.srcW, tt.srcH, tt.dstW, tt.dstH)
+		if math.Abs(sx-tt.sx) > 1e-9 || math.Abs(sy-tt.sy) > 1e-9 {
+			t.Errorf("fitting %gx%g into %gx%g by %v scales by %g, %g; want %g, %g",
+				tt.srcW, tt.srcH, tt.dstW, tt.dstH, tt.fit, sx, sy, tt.sx, tt.sy)
+		}
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	// a square card, white on a transparent ground, into a tall slot
+	card := image.NewNRGBA(image.Rect(10, 10, 50, 50))
+	for y := 10; y < 50; y++ {
+		for x := 10; x < 50; x++ {
+			card.Set(x, y, color.White)
+		}
+	}
+	tests := []struct {
+		fit    fitMode
+		filled image.Rectangle // where the card lands in the slot
+	}{
+		{fitCrop, image.Rect(0, 0, 20, 30)},
+		{fitLetterbox, image.Rect(0, 5, 20, 25)},
+		{fitStretch, image.Rect(0, 0, 20, 30)},
+	}
+	for _, tt := range tests {
+		got := tt.fit.fitImage(card, image.Pt(20, 30))
+		if got.Bounds() != image.Rect(0, 0, 20, 30) {
+			t.Errorf("fitting by %v gave an image of %v", tt.fit, got.Bounds())
+			continue
+		}
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 20; x++ {
+				_, _, _, a := got.At(x, y).RGBA()
+				if in := image.Pt(x, y).In(tt.filled); in != (a > 0) {
+					t.Fatalf("fitting by %v gave an alpha of %d at %d,%d", tt.fit, a, x, y)
+				}
+			}
+		}
+	}
+}
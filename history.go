@@ -0,0 +1,91 @@
+package main
+
+// the history of saved readings can be searched, so that past
+// readings for a client can be found again: by deck, layout,
+// client, the dates they were dealt, or a card that came up.
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistory = 50 // readings listed when no limit is given
+	dateLayout     = "2006-01-02"
+)
+
+type historyFilter struct {
+	deck, layout, client string
+	card                 string // lower-cased, matched anywhere in a card's name
+	from, to             time.Time
+	limit                int
+}
+
+// newHistoryFilter reads the search from the parameters.  Dates
+// are given as YYYY-MM-DD in the server's time zone, and both ends
+// of the range are included.
+func newHistoryFilter(params url.Values) (*historyFilter, error) {
+	hf := &historyFilter{
+		deck:   params.Get("deck"),
+		layout: params.Get("layout"),
+		client: params.Get("client"),
+		card:   strings.ToLower(params.Get("card")),
+		limit:  defaultHistory,
+	}
+
+	var err error
+	if s := params.Get("from"); s != "" {
+		if hf.from, err = time.ParseInLocation(dateLayout, s, time.Local); err != nil {
+			return nil, fmt.Errorf("bad from date %q", s)
+		}
+	}
+	if s := params.Get("to"); s != "" {
+		if hf.to, err = time.ParseInLocation(dateLayout, s, time.Local); err != nil {
+			return nil, fmt.Errorf("bad to date %q", s)
+		}
+		hf.to = hf.to.AddDate(0, 0, 1)
+	}
+	if s := params.Get("limit"); s != "" {
+		if hf.limit, err = strconv.Atoi(s); err != nil || hf.limit < 1 {
+			return nil, fmt.Errorf("bad limit %q", s)
+		}
+	}
+	return hf, nil
+}
+
+func (hf *historyFilter) matches(rd *reading) bool {
+	switch {
+	case hf.deck != "" && rd.Deck != hf.deck,
+		hf.layout != "" && rd.Layout != hf.layout,
+		hf.client != "" && !strings.EqualFold(rd.Client, hf.client),
+		!hf.from.IsZero() && rd.Time.Before(hf.from),
+		!hf.to.IsZero() && !rd.Time.Before(hf.to):
+		return false
+	case hf.card == "":
+		return true
+	}
+	for _, dc := range rd.Cards {
+		if !dc.FaceDown && strings.Contains(strings.ToLower(dc.Name), hf.card) {
+			return true
+		}
+	}
+	return false
+}
+
+// search gives copies of the saved readings that match the
+// filter, newest first, with their face-down cards concealed.
+func (rs *readingStore) search(hf *historyFilter) []*reading {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	answer := make([]*reading, 0)
+	for idx := len(rs.order) - 1; idx >= 0 && len(answer) < hf.limit; idx-- {
+		if rd := rs.order[idx]; hf.matches(rd) {
+			answer = append(answer, rd.concealed())
+		}
+	}
+	return answer
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHistoryFilter(t *testing.T) {
+	tests := []struct {
+		query    string
+		from, to string // as dates; "-" for none
+		limit    int    // zero when it fails
+	}{
+		{"", "-", "-", defaultHistory},
+		{"from=2024-03-01&to=2024-03-31", "2024-03-01", "2024-04-01", defaultHistory},
+		{"to=2024-12-31&limit=5", "-", "2025-01-01", 5},
+		{"card=The%20Fool&client=Ann", "-", "-", defaultHistory},
+		{"from=March", "", "", 0},
+		{"to=2024-02-30", "", "", 0},
+		{"limit=0", "", "", 0},
+		{"limit=lots", "", "", 0},
+	}
+	date := func(d time.Time) string {
+		if d.IsZero() {
+			return "-"
+		}
+		return d.Format(dateLayout)
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		hf, err := newHistoryFilter(params)
+		if tt.limit == 0 {
+			if err == nil {
+				t.Errorf("newHistoryFilter(%q) succeeded, want an error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newHistoryFilter(%q): %v", tt.query, err)
+			continue
+		}
+		if date(hf.from) != tt.from || date(hf.to) != tt.to || hf.limit != tt.limit {
+			t.Errorf("newHistoryFilter(%q) runs from %s up to %s, for %d; want %s, %s and %d",
+				tt.query, date(hf.from), date(hf.to), hf.limit, tt.from, tt.to, tt.limit)
+		}
+	}
+}
+
+func TestHistoryMatches(t *testing.T) {
+	at := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return d
+	}
+	rd := &reading{
+		Time:   at("2024-03-10 23:59"),
+		Deck:   "Tarot",
+		Layout: "celtic",
+		Client: "Ann",
+		Cards: []drawnCard{
+			{Name: "The Fool"},
+			{Name: "Queen of Cups", FaceDown: true},
+			{Name: "Ten of Cups", FaceDown: true},
+		},
+	}
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"deck=Tarot&layout=celtic", true},
+		{"deck=Poker", false},
+		{"layout=row", false},
+		{"client=ann", true},
+		{"client=Bob", false},
+
+		// both ends of the range are included, all day
+		{"from=2024-03-10", true},
+		{"from=2024-03-11", false},
+		{"to=2024-03-10", true},
+		{"to=2024-03-09", false},
+		{"from=2024-03-01&to=2024-03-31", true},
+
+		// cards are matched by any part of their names, but
+		// face-down cards don't give themselves away
+		{"card=fool", true},
+		{"card=THE FOOL", true},
+		{"card=queen", false},
+		{"card=cups", false},
+		{"card=fool&deck=Poker", false},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		hf, err := newHistoryFilter(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hf.matches(rd); got != tt.match {
+			t.Errorf("%q matches %v, want %v", tt.query, got, tt.match)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	rs := &readingStore{byID: make(map[string]*reading)}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		rs.add(&reading{ID: id, Deck: "Tarot", Cards: []drawnCard{
+			{Index: 3, Name: "The Empress"},
+			{Index: 7, Name: "The Chariot", FaceDown: true},
+		}})
+	}
+	rs.add(&reading{ID: "e", Deck: "Poker"})
+
+	hf, _ := newHistoryFilter(url.Values{"deck": {"Tarot"}, "limit": {"3"}})
+	var ids []string
+	for _, rd := range rs.search(hf) {
+		ids = append(ids, rd.ID)
+		if dc := rd.Cards[1]; dc.Name != "" || dc.Index != backCard {
+			t.Errorf("search gave away face-down card %+v in reading %s", dc, rd.ID)
+		}
+	}
+	if got := strings.Join(ids, " "); got != "d c b" {
+		t.Errorf("search found %q, want the newest three: d c b", got)
+	}
+
+	// the saved readings themselves are left alone
+	if dc := rs.byID["d"].Cards[1]; dc.Name != "The Chariot" {
+		t.Errorf("search changed the saved reading's card to %+v", dc)
+	}
+}
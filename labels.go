@@ -0,0 +1,153 @@
+package main
+
+// labels name the positions of a reading, and the cards in them,
+// right in the image, so that a printout can't be misread.  They
+// are drawn in a small bitmap font, enlarged to suit the size of
+// the cards.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// a labelSet tells which lines of text go with each card.
+type labelSet struct {
+	number   bool // the position's number, counting from 1
+	position bool // the position's name
+	name     bool // the card's name
+}
+
+// parseLabels reads a comma-separated list of number, position
+// and name; "both" means position and name, as for PDF captions.
+func parseLabels(s string) (labelSet, error) {
+	var ls labelSet
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		switch strings.TrimSpace(part) {
+		case "", "none":
+		case "number":
+			ls.number = true
+		case "position":
+			ls.position = true
+		case "name":
+			ls.name = true
+		case "both":
+			ls.position, ls.name = true, true
+		default:
+			return ls, fmt.Errorf("unknown label %q", part)
+		}
+	}
+	return ls, nil
+}
+
+// lines gives the text of the label for the card in the idx'th
+// position.  Face-down cards keep their names to themselves.
+func (ls labelSet) lines(idx int, dc drawnCard) []string {
+	var answer []string
+	var pos string
+	if ls.number {
+		pos = strconv.Itoa(idx + 1)
+	}
+	if ls.position && dc.Position != "" {
+		if pos != "" {
+			pos += ". "
+		}
+		pos += dc.Position
+	}
+	if pos != "" {
+		answer = append(answer, pos)
+	}
+	if ls.name && !dc.FaceDown && dc.Name != "" {
+		answer = append(answer, dc.Name)
+	}
+	return answer
+}
+
+// labels go below each card, or over the bottom of it
+func parseLabelsOver(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "", "below":
+		return false, nil
+	case "over":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown label placement %q", s)
+}
+
+var (
+	labelFace     = basicfont.Face7x13
+	labelText     = color.White
+	labelBackdrop = color.NRGBA{0, 0, 0, 0xa0}
+)
+
+// labelScale gives how much to enlarge the font for cards of
+// the given width, so that the text stays in proportion.
+func labelScale(cardWidth int) int {
+	if s := cardWidth / 120; s > 1 {
+		return s
+	}
+	return 1
+}
+
+// labelHeight gives the height of a label with n lines.
+func labelHeight(n, scale int) int {
+	if n == 0 {
+		return 0
+	}
+	return (n*labelFace.Height + 4) * scale
+}
+
+// labelRect gives where the label goes for a card.  A tilted card
+// only fills part of its rectangle, so its label is kept to the
+// card's own width.
+func (rd *reading) labelRect(dc drawnCard, n, scale int, over bool) image.Rectangle {
+	r := dc.Rect.image()
+	if dc.Tilt != 0 && rd.CardWidth < r.Dx() {
+		inset := (r.Dx() - rd.CardWidth) / 2
+		r.Min.X, r.Max.X = r.Min.X+inset, r.Max.X-inset
+	}
+	h := labelHeight(n, scale)
+	if over {
+		return image.Rect(r.Min.X, r.Max.Y-h, r.Max.X, r.Max.Y)
+	}
+	return image.Rect(r.Min.X, r.Max.Y, r.Max.X, r.Max.Y+h)
+}
+
+// drawLabel writes the lines, centered, on a dark backdrop
+// filling the rectangle.  Lines too long for it are cut short.
+func drawLabel(dst draw.Image, r image.Rectangle, lines []string, scale int) {
+	draw.Draw(dst, r, &image.Uniform{labelBackdrop}, image.ZP, draw.Over)
+
+	// draw the text at the font's own size, then enlarge it
+	adv := labelFace.Advance
+	small := image.NewRGBA(image.Rect(0, 0, r.Dx()/scale, r.Dy()/scale))
+	d := font.Drawer{Dst: small, Src: &image.Uniform{labelText}, Face: labelFace}
+	for idx, line := range lines {
+		text := []rune(line)
+		if fits := (small.Bounds().Dx() - 4) / adv; len(text) > fits && fits > 0 {
+			if fits > 3 {
+				text = append(text[:fits-3], []rune("...")...)
+			} else {
+				text = text[:fits]
+			}
+		}
+		x := (small.Bounds().Dx() - len(text)*adv) / 2
+		d.Dot = fixed.P(x, 2+idx*labelFace.Height+labelFace.Ascent)
+		d.DrawString(string(text))
+	}
+
+	var text image.Image = small
+	if scale > 1 {
+		b := small.Bounds()
+		text = resize.Resize(uint(b.Dx()*scale), uint(b.Dy()*scale), small, resize.NearestNeighbor)
+	}
+	draw.Draw(dst, r, text, text.Bounds().Min, draw.Over)
+}
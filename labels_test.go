@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  labelSet
+		fails bool
+	}{
+		{"", labelSet{}, false},
+		{"none", labelSet{}, false},
+		{"number", labelSet{number: true}, false},
+		{"Position, NAME", labelSet{position: true, name: true}, false},
+		{"both", labelSet{position: true, name: true}, false},
+		{"number,both", labelSet{true, true, true}, false},
+		{"number,,name", labelSet{number: true, name: true}, false},
+		{"suit", labelSet{}, true},
+		{"name,meaning", labelSet{}, true},
+	}
+	for _, tt := range tests {
+		ls, err := parseLabels(tt.s)
+		switch {
+		case tt.fails:
+			if err == nil {
+				t.Errorf("parseLabels(%q) = %+v, want an error", tt.s, ls)
+			}
+		case err != nil:
+			t.Errorf("parseLabels(%q): %v", tt.s, err)
+		case ls != tt.want:
+			t.Errorf("parseLabels(%q) = %+v, want %+v", tt.s, ls, tt.want)
+		}
+	}
+}
+
+func TestLabelLines(t *testing.T) {
+	up := drawnCard{Position: "Past", Name: "The Tower"}
+	down := drawnCard{Position: "Past", Name: "The Tower", FaceDown: true}
+	nameless := drawnCard{Name: "The Tower"}
+	tests := []struct {
+		labels string
+		dc     drawnCard
+		lines  string // joined with |
+	}{
+		{"", up, ""},
+		{"number", up, "3"},
+		{"position", up, "Past"},
+		{"number,position", up, "3. Past"},
+		{"name", up, "The Tower"},
+		{"both", up, "Past|The Tower"},
+		{"number,both", up, "3. Past|The Tower"},
+		{"both", down, "Past"},
+		{"name", down, ""},
+		{"number,position", nameless, "3"},
+		{"position", nameless, ""},
+	}
+	for _, tt := range tests {
+		ls, err := parseLabels(tt.labels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(ls.lines(2, tt.dc), "|"); got != tt.lines {
+			t.Errorf("labels=%s on %+v gave %q, want %q", tt.labels, tt.dc, got, tt.lines)
+		}
+	}
+}
+
+func TestParseLabelsOver(t *testing.T) {
+	tests := []struct {
+		s     string
+		over  bool
+		fails bool
+	}{
+		{"", false, false},
+		{"below", false, false},
+		{"Over", true, false},
+		{"above", false, true},
+	}
+	for _, tt := range tests {
+		over, err := parseLabelsOver(tt.s)
+		if (err != nil) != tt.fails || over != tt.over {
+			t.Errorf("parseLabelsOver(%q) = %v, %v; want %v, failing %v", tt.s, over, err, tt.over, tt.fails)
+		}
+	}
+}
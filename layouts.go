@@ -0,0 +1,471 @@
+package main
+
+// layouts that are generated from the request parameters,
+// rather than loaded from a spread file.
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerLayout("row", "Row of Cards", []string{"cards", "pct", "shape", "sweep", "radius"}, layoutFunc(rowSpread))
+
+	registerLayout("grid", "Grid of Cards", []string{"rows", "cols", "count", "align"}, layoutFunc(gridSpread))
+	registerLayout("tableau", "Grand Tableau", []string{"variant"}, deckedLayout{layoutFunc(tableauSpread), safeDeck})
+
+	wheelParams := []string{"start", "dir", "facing", "center"}
+	registerLayout("wheel", "Wheel of Cards", append([]string{"cards"}, wheelParams...),
+		wheelPreset{display: "Wheel of Cards", start: 90, clockwise: true})
+	registerLayout("zodiac", "Zodiac Wheel", wheelParams,
+		wheelPreset{display: "Zodiac Wheel", names: ordinals(12, "House"), start: 180})
+	registerLayout("sabbats", "Wheel of the Year", wheelParams,
+		wheelPreset{display: "Wheel of the Year", names: sabbats, start: 90, clockwise: true})
+	registerLayout("moons", "Thirteen Moons", wheelParams,
+		wheelPreset{display: "Thirteen Moons", names: ordinals(13, "Moon"), start: 90, clockwise: true})
+	registerLayout("year", "Year Ahead", wheelParams,
+		wheelPreset{display: "Year Ahead", names: ordinals(12, "Month"), start: 90, clockwise: true, center: "The Year"})
+}
+
+// rowSpread generates a spread of cards in a row, with optional
+// overlap.  The row can also be bent into a fan or an arc.
+func rowSpread(params url.Values, ds deckShape) (*spread, error) {
+	desiredCards, _ := strconv.Atoi(getOrElse(params["cards"], "3"))
+	desiredShowing, _ := strconv.Atoi(getOrElse(params["pct"], "100"))
+	if desiredCards < 1 {
+		desiredCards = 1
+	}
+	if err := ds.fits(desiredCards); err != nil {
+		return nil, err
+	}
+	switch shape := strings.ToLower(params.Get("shape")); shape {
+	case "", "line":
+	case "fan", "arc":
+		return curvedRow(shape == "fan", desiredCards, params, ds.ratio)
+	default:
+		return nil, fmt.Errorf("bad shape %q", shape)
+	}
+
+	// to account for overlap, we figure out the number of
+	// cards effectively showing.  Thus 3 cards showing at 100%
+	// would be 1 + 1 + 1, while at 80% it would be .8 + .8 + 1
+	// (since the last card is fully visible)
+	showPct := float64(desiredShowing) / 100.0
+	answer := &spread{
+		Display:   "Row of Cards",
+		Width:     1.0 + float64(desiredCards-1)*showPct,
+		Height:    1.0,
+		Positions: make([]position, desiredCards),
+	}
+	for idx := range answer.Positions {
+		answer.Positions[idx] = position{
+			Name: strconv.Itoa(idx + 1),
+			X:    float64(idx)*showPct + 0.5,
+			Y:    0.5,
+		}
+	}
+	return answer, answer.validate()
+}
+
+// gridSpread lays cards out in rows and columns.  By default the
+// grid is full, but a count of cards can leave the last row short,
+// lined up to the left, center or right.  Given a count and only
+// one of rows or columns, the grid grows to fit the cards.
+func gridSpread(params url.Values, ds deckShape) (*spread, error) {
+	rows, err := countParam(params, "rows")
+	if err != nil {
+		return nil, err
+	}
+	cols, err := countParam(params, "cols")
+	if err != nil {
+		return nil, err
+	}
+	count, err := countParam(params, "count")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case count > 0 && rows == 0 && cols == 0:
+		cols = int(math.Ceil(math.Sqrt(float64(count))))
+		rows = (count + cols - 1) / cols
+	case count > 0 && rows == 0:
+		rows = (count + cols - 1) / cols
+	case count > 0 && cols == 0:
+		cols = (count + rows - 1) / rows
+	default:
+		if rows == 0 {
+			rows = 3
+		}
+		if cols == 0 {
+			cols = 3
+		}
+	}
+	if rows > ds.cards || cols > ds.cards {
+		return nil, fmt.Errorf("a grid of %d rows of %d is too big for the deck", rows, cols)
+	}
+	if count == 0 {
+		count = rows * cols
+	}
+	if count > rows*cols {
+		return nil, fmt.Errorf("%d cards don't fit in %d rows of %d", count, rows, cols)
+	}
+	if err := ds.fits(count); err != nil {
+		return nil, err
+	}
+
+	// how far to shift the short last row, as a share of its gap
+	var shift float64
+	switch strings.ToLower(params.Get("align")) {
+	case "", "left":
+	case "center":
+		shift = 0.5
+	case "right":
+		shift = 1.0
+	default:
+		return nil, fmt.Errorf("bad alignment %q", params.Get("align"))
+	}
+	return gridOf("Grid of Cards", cols, count, shift), nil
+}
+
+// tableauSpread lays out a Grand Tableau.  The classic tableau is
+// four rows of eight with the last four cards centered below them;
+// the 4x9 variant is four rows of nine.  The deck variant deals the
+// whole deck, in rows about twice as long as the tableau is tall.
+func tableauSpread(params url.Values, ds deckShape) (*spread, error) {
+	var cols, count int
+	switch variant := strings.ToLower(params.Get("variant")); variant {
+	case "", "classic":
+		cols, count = 8, 36
+	case "4x9":
+		cols, count = 9, 36
+	case "deck":
+		count = ds.cards
+		cols = int(math.Ceil(math.Sqrt(2 * float64(count))))
+	default:
+		return nil, fmt.Errorf("bad tableau variant %q", variant)
+	}
+	if count < 1 {
+		return nil, fmt.Errorf("the deck has no cards for a tableau")
+	}
+	if count > ds.cards {
+		return nil, fmt.Errorf("a tableau of %d cards needs a bigger deck than %d cards; try variant=deck",
+			count, ds.cards)
+	}
+	return gridOf("Grand Tableau", cols, count, 0.5), nil
+}
+
+// gridOf lays count cards out in rows of cols, numbering them
+// from 1.  A short last row is shifted across by the given share
+// of the gap it leaves.
+func gridOf(display string, cols, count int, shift float64) *spread {
+	lastRow := (count - 1) / cols
+	answer := &spread{
+		Display:   display,
+		Width:     float64(cols),
+		Height:    float64(lastRow + 1),
+		Positions: make([]position, count),
+	}
+	for idx := range answer.Positions {
+		row, col := idx/cols, idx%cols
+		x := float64(col) + 0.5
+		if row == lastRow {
+			x += shift * float64(cols*(lastRow+1)-count)
+		}
+		answer.Positions[idx] = position{
+			Name: strconv.Itoa(idx + 1),
+			X:    x,
+			Y:    float64(row) + 0.5,
+		}
+	}
+	return answer
+}
+
+// fits checks that the deck has enough cards for n positions,
+// before a layout goes to the trouble of placing them.
+func (ds deckShape) fits(n int) error {
+	if n > ds.cards {
+		return fmt.Errorf("the deck has too few cards for %d positions", n)
+	}
+	return nil
+}
+
+// countParam parses a parameter counting something, which is
+// zero when not given.
+func countParam(params url.Values, name string) (int, error) {
+	s := params.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("bad %s %q", name, s)
+	}
+	return n, nil
+}
+
+// a wheelPreset gives the defaults for a wheel layout.  When it
+// names the positions, that also fixes the number of cards.  When
+// it names a center card, that card is dealt unless center=0.
+type wheelPreset struct {
+	display   string
+	names     []string
+	start     float64 // degrees counter-clockwise from 3 o'clock
+	clockwise bool
+	center    string
+}
+
+func (wp wheelPreset) Spread(params url.Values, ds deckShape) (*spread, error) {
+	return wheelSpread(wp, params, ds)
+}
+
+// positionNames gives the names of the positions, when they don't
+// depend on the request.
+func (wp wheelPreset) positionNames() []string {
+	if len(wp.names) == 0 {
+		return nil
+	}
+	if wp.center != "" {
+		return append(wp.names[:len(wp.names):len(wp.names)], wp.center)
+	}
+	return wp.names
+}
+
+var sabbats = []string{"Yule", "Imbolc", "Ostara", "Beltane", "Litha", "Lughnasadh", "Mabon", "Samhain"}
+
+// ordinals names n positions "1st House", "2nd House", and so on.
+func ordinals(n int, noun string) []string {
+	answer := make([]string, n)
+	for idx := range answer {
+		num := idx + 1
+		suffix := "th"
+		if num%100 < 11 || num%100 > 13 {
+			switch num % 10 {
+			case 1:
+				suffix = "st"
+			case 2:
+				suffix = "nd"
+			case 3:
+				suffix = "rd"
+			}
+		}
+		answer[idx] = fmt.Sprintf("%d%s %s", num, suffix, noun)
+	}
+	return answer
+}
+
+// wheelSpread places cards evenly around a circle, starting at the
+// given angle and going either way around.  The cards can stand
+// upright, or turn to face in toward the center or out away from it,
+// and another card can sit in the middle.  Since the circle has to
+// be round in pixels, the layout depends on the shape of the cards.
+func wheelSpread(wp wheelPreset, params url.Values, ds deckShape) (*spread, error) {
+	names := wp.names
+	if len(names) == 0 {
+		n, _ := strconv.Atoi(getOrElse(params["cards"], "12"))
+		if n < 1 {
+			n = 1
+		}
+		if err := ds.fits(n); err != nil {
+			return nil, err
+		}
+		names = make([]string, n)
+		for idx := range names {
+			names[idx] = strconv.Itoa(idx + 1)
+		}
+	}
+
+	start := wp.start
+	if s := params.Get("start"); s != "" {
+		var err error
+		if start, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("bad start %q", s)
+		}
+	}
+	clockwise := wp.clockwise
+	switch strings.ToLower(params.Get("dir")) {
+	case "":
+	case "cw":
+		clockwise = true
+	case "ccw":
+		clockwise = false
+	default:
+		return nil, fmt.Errorf("bad direction %q", params.Get("dir"))
+	}
+
+	// turn gives a card's rotation, from its angle around the wheel
+	var turn func(angle float64) float64
+	switch strings.ToLower(params.Get("facing")) {
+	case "", "upright":
+		turn = func(angle float64) float64 { return 0 }
+	case "inward":
+		turn = func(angle float64) float64 { return angle + 90 }
+	case "outward":
+		turn = func(angle float64) float64 { return angle - 90 }
+	default:
+		return nil, fmt.Errorf("bad facing %q", params.Get("facing"))
+	}
+	center := wp.center != ""
+	switch strings.ToLower(params.Get("center")) {
+	case "":
+	case "1", "true", "yes", "on":
+		center = true
+	case "0", "false", "no", "off":
+		center = false
+	default:
+		return nil, fmt.Errorf("bad center %q", params.Get("center"))
+	}
+
+	total := len(names)
+	if center {
+		total++
+	}
+	if err := ds.fits(total); err != nil {
+		return nil, err
+	}
+
+	// work in card widths, both across and down
+	ratio := ds.ratio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	w, h := 1.0, 1.0/ratio
+	diag := math.Hypot(w, h)
+
+	// upright neighbors need to be apart by the longer side of a
+	// card, with a bit to spare.  Cards facing in or out crowd
+	// together at their inner ends, which need to be a card's width
+	// apart.  The ring also has to clear a center card.
+	n := len(names)
+	facing := params.Get("facing") != "" && !strings.EqualFold(params.Get("facing"), "upright")
+	radius, depth := 0.0, diag
+	chord := 2 * math.Sin(math.Pi/float64(n))
+	switch {
+	case n == 1:
+	case facing:
+		radius, depth = 1.1*w/chord+h/2, h
+	default:
+		radius = 1.15 * math.Max(w, h) / chord
+	}
+	if center {
+		radius = math.Max(radius, (diag+depth)/2+0.15*w)
+	}
+
+	cards := make([]placed, 0, n+1)
+	for idx := 0; idx < n; idx++ {
+		step := 360.0 * float64(idx) / float64(n)
+		if clockwise {
+			step = -step
+		}
+		angle := math.Mod(start+step, 360)
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		cards = append(cards, placed{radius * cos, -radius * sin, turn(angle)})
+	}
+	if center {
+		cards = append(cards, placed{0, 0, 0})
+		centerName := wp.center
+		if centerName == "" {
+			centerName = "Center"
+		}
+		names = append(names[:n:n], centerName)
+	}
+	return placedSpread(wp.display, names, cards, ratio)
+}
+
+// a placed card is centered at x and y, measured in card widths
+// both across and down, and rotated by rot degrees.
+type placed struct {
+	x, y, rot float64
+}
+
+// placedSpread makes a spread of the placed cards, cropped
+// close around them.
+func placedSpread(display string, names []string, cards []placed, ratio float64) (*spread, error) {
+	w, h := 1.0, 1.0/ratio
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range cards {
+		sin, cos := math.Sincos(c.rot * math.Pi / 180)
+		hw := (math.Abs(cos)*w + math.Abs(sin)*h) / 2
+		hh := (math.Abs(sin)*w + math.Abs(cos)*h) / 2
+		minX, maxX = math.Min(minX, c.x-hw), math.Max(maxX, c.x+hw)
+		minY, maxY = math.Min(minY, c.y-hh), math.Max(maxY, c.y+hh)
+	}
+
+	answer := &spread{
+		Display:      display,
+		Width:        maxX - minX,
+		Height:       (maxY - minY) / h,
+		Positions:    make([]position, len(cards)),
+		proportional: true,
+	}
+	for idx, c := range cards {
+		answer.Positions[idx] = position{
+			Name:     names[idx],
+			X:        c.x - minX,
+			Y:        (c.y - minY) / h,
+			Rotation: c.rot,
+		}
+	}
+	return answer, answer.validate()
+}
+
+// curvedRow bends a row of cards around a circle, whose center is
+// below the cards.  In a fan, each card turns to point away from
+// the center, like a hand of cards; in an arc, they stay upright.
+// The sweep is the angle from the first card to the last, and the
+// radius (in card heights) is the distance from the center to the
+// middle of each card.
+func curvedRow(fan bool, n int, params url.Values, ratio float64) (*spread, error) {
+	if ratio <= 0 {
+		ratio = 1
+	}
+	w, h := 1.0, 1.0/ratio
+
+	sweep := 90.0
+	if fan {
+		sweep = 60.0
+	}
+	if s := params.Get("sweep"); s != "" {
+		var err error
+		if sweep, err = strconv.ParseFloat(s, 64); err != nil || sweep < 0 || sweep > 360 {
+			return nil, fmt.Errorf("bad sweep %q", s)
+		}
+	}
+
+	// by default, a fan pivots just below the cards, while an arc
+	// is wide enough that neighbors don't overlap
+	radius := h
+	if !fan && n > 1 && sweep > 0 {
+		radius = 1.1 * w / (2 * math.Sin(sweep*math.Pi/360/float64(n-1)))
+	}
+	if s := params.Get("radius"); s != "" {
+		r, err := strconv.ParseFloat(s, 64)
+		if err != nil || r < 0 {
+			return nil, fmt.Errorf("bad radius %q", s)
+		}
+		radius = r * h
+	}
+
+	names := make([]string, n)
+	cards := make([]placed, n)
+	for idx := range cards {
+		// the first card goes on the left, and the middle card is
+		// straight up from the center
+		angle := 90.0
+		if n > 1 {
+			angle += sweep/2 - sweep*float64(idx)/float64(n-1)
+		}
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		cards[idx] = placed{x: radius * cos, y: -radius * sin}
+		if fan {
+			cards[idx].rot = angle - 90
+		}
+		names[idx] = strconv.Itoa(idx + 1)
+	}
+	return placedSpread("Row of Cards", names, cards, ratio)
+}
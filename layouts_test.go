@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// where gives the centers of a spread's positions, as "x,y".
+func where(spr *spread) string {
+	var answer []string
+	for _, p := range spr.Positions {
+		answer = append(answer, fmt.Sprintf("%g,%g", p.X, p.Y))
+	}
+	return strings.Join(answer, " ")
+}
+
+func TestGridOf(t *testing.T) {
+	tests := []struct {
+		cols, count   int
+		shift         float64
+		width, height float64
+		centers       string
+	}{
+		{3, 3, 0, 3, 1, "0.5,0.5 1.5,0.5 2.5,0.5"},
+		{2, 4, 0.5, 2, 2, "0.5,0.5 1.5,0.5 0.5,1.5 1.5,1.5"},
+		{3, 4, 0, 3, 2, "0.5,0.5 1.5,0.5 2.5,0.5 0.5,1.5"},
+		{3, 4, 0.5, 3, 2, "0.5,0.5 1.5,0.5 2.5,0.5 1.5,1.5"},
+		{3, 5, 1, 3, 2, "0.5,0.5 1.5,0.5 2.5,0.5 1.5,1.5 2.5,1.5"},
+		{1, 2, 0.5, 1, 2, "0.5,0.5 0.5,1.5"},
+	}
+	for _, tt := range tests {
+		spr := gridOf("Test", tt.cols, tt.count, tt.shift)
+		if spr.Width != tt.width || spr.Height != tt.height {
+			t.Errorf("gridOf(%d, %d) is %gx%g, want %gx%g",
+				tt.cols, tt.count, spr.Width, spr.Height, tt.width, tt.height)
+		}
+		if got := where(spr); got != tt.centers {
+			t.Errorf("gridOf(%d, %d, %g) put cards at %s, want %s", tt.cols, tt.count, tt.shift, got, tt.centers)
+		}
+		if spr.Positions[tt.count-1].Name != fmt.Sprint(tt.count) {
+			t.Errorf("gridOf(%d, %d) named the last card %q", tt.cols, tt.count, spr.Positions[tt.count-1].Name)
+		}
+	}
+}
+
+func TestGridSpread(t *testing.T) {
+	tests := []struct {
+		query      string
+		cols, rows int // of the spread; zero when it fails
+		count      int
+	}{
+		{"", 3, 3, 9},
+		{"rows=4&cols=9", 9, 4, 36},
+		{"count=10", 4, 3, 10},
+		{"count=10&rows=2", 5, 2, 10},
+		{"count=10&cols=3", 3, 4, 10},
+		{"rows=2&cols=2&count=3&align=right", 2, 2, 3},
+		{"rows=2&cols=2&count=5", 0, 0, 0},
+		{"rows=0", 0, 0, 0},
+		{"align=top", 0, 0, 0},
+		{"count=53", 0, 0, 0},
+		{"rows=100000&cols=100000", 0, 0, 0},
+		{"count=1000000000000000000", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		spr, err := gridSpread(params, deckShape{0.7, 52})
+		if tt.count == 0 {
+			if err == nil {
+				t.Errorf("gridSpread(%q) succeeded, want an error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("gridSpread(%q): %v", tt.query, err)
+			continue
+		}
+		if int(spr.Width) != tt.cols || int(spr.Height) != tt.rows || len(spr.Positions) != tt.count {
+			t.Errorf("gridSpread(%q) gave %d cards in %gx%g, want %d in %dx%d", tt.query,
+				len(spr.Positions), spr.Width, spr.Height, tt.count, tt.cols, tt.rows)
+		}
+	}
+}
+
+func TestTableauSpread(t *testing.T) {
+	tests := []struct {
+		variant       string
+		cards         int
+		width, height float64 // zero when it fails
+	}{
+		{"", 52, 8, 5},
+		{"classic", 36, 8, 5},
+		{"4x9", 36, 9, 4},
+		{"deck", 78, 13, 6},
+		{"deck", 52, 11, 5},
+		{"deck", 36, 9, 4},
+		{"classic", 32, 0, 0},
+		{"5x5", 52, 0, 0},
+	}
+	for _, tt := range tests {
+		spr, err := tableauSpread(url.Values{"variant": {tt.variant}}, deckShape{0.7, tt.cards})
+		if tt.width == 0 {
+			if err == nil {
+				t.Errorf("tableau %q of %d cards succeeded, want an error", tt.variant, tt.cards)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tableau %q of %d cards: %v", tt.variant, tt.cards, err)
+			continue
+		}
+		if spr.Width != tt.width || spr.Height != tt.height {
+			t.Errorf("tableau %q of %d cards is %gx%g, want %gx%g",
+				tt.variant, tt.cards, spr.Width, spr.Height, tt.width, tt.height)
+		}
+	}
+}
+
+// centers gives where the positions' centers fall, in card widths
+// both across and down.
+func centers(spr *spread, ratio float64) [][2]float64 {
+	var answer [][2]float64
+	for _, p := range spr.Positions {
+		answer = append(answer, [2]float64{p.X, p.Y / ratio})
+	}
+	return answer
+}
+
+func TestWheelSpread(t *testing.T) {
+	tests := []struct {
+		preset wheelPreset
+		query  string
+		names  string // the first and last names; empty when it fails
+		n      int
+	}{
+		{wheelPreset{start: 90}, "", "1 12", 12},
+		{wheelPreset{start: 90}, "cards=5&facing=inward", "1 5", 5},
+		{wheelPreset{start: 90}, "cards=6&center=1", "1 Center", 7},
+		{wheelPreset{names: sabbats, start: 90, clockwise: true}, "facing=outward", "Yule Samhain", 8},
+		{wheelPreset{names: ordinals(12, "Month"), center: "The Year"}, "", "1st Month The Year", 13},
+		{wheelPreset{names: ordinals(12, "Month"), center: "The Year"}, "center=0", "1st Month 12th Month", 12},
+		{wheelPreset{start: 90}, "cards=52&center=1", "", 0},
+		{wheelPreset{start: 90}, "center=maybe", "", 0},
+		{wheelPreset{start: 90}, "dir=up", "", 0},
+		{wheelPreset{start: 90}, "facing=sideways", "", 0},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		spr, err := wheelSpread(tt.preset, params, deckShape{0.7, 52})
+		if tt.names == "" {
+			if err == nil {
+				t.Errorf("wheel %q succeeded, want an error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("wheel %q: %v", tt.query, err)
+			continue
+		}
+		if len(spr.Positions) != tt.n {
+			t.Fatalf("wheel %q has %d positions, want %d", tt.query, len(spr.Positions), tt.n)
+		}
+		if got := spr.Positions[0].Name + " " + spr.Positions[tt.n-1].Name; got != tt.names {
+			t.Errorf("wheel %q runs from %q, want %q", tt.query, got, tt.names)
+		}
+
+		// the ring is round, however tall the cards are
+		ring := len(spr.Positions)
+		if strings.Contains(tt.names, "Center") || strings.Contains(tt.names, "The Year") {
+			ring--
+		}
+		pts := centers(spr, 0.7)
+		mid := [2]float64{}
+		for _, p := range pts[:ring] {
+			mid[0] += p[0] / float64(ring)
+			mid[1] += p[1] / float64(ring)
+		}
+		radius := math.Hypot(pts[0][0]-mid[0], pts[0][1]-mid[1])
+		for idx, p := range pts[:ring] {
+			if r := math.Hypot(p[0]-mid[0], p[1]-mid[1]); math.Abs(r-radius) > 1e-9 {
+				t.Errorf("wheel %q has card %d at %g from the middle, and card 0 at %g", tt.query, idx, r, radius)
+			}
+		}
+		if ring < len(pts) {
+			if c := pts[ring]; math.Hypot(c[0]-mid[0], c[1]-mid[1]) > 1e-9 {
+				t.Errorf("wheel %q has its center card off the middle", tt.query)
+			}
+		}
+	}
+}
+
+func TestWheelFacing(t *testing.T) {
+	// cards turned toward the center are upended at the top of the
+	// wheel, but none are reversed with rev=0
+	for _, facing := range []string{"upright", "inward", "outward"} {
+		spr, err := wheelSpread(wheelPreset{start: 90}, url.Values{"cards": {"12"}, "facing": {facing}}, deckShape{0.7, 52})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd, err := spr.deal(rand.New(rand.NewSource(1)), testDeck(12), 600, 0, spacing{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upended := 0
+		for idx, dc := range rd.Cards {
+			if dc.Reversed {
+				t.Errorf("facing=%s reversed the card in position %d, with rev=0", facing, idx)
+			}
+			if dc.Upended {
+				upended++
+			}
+		}
+		if top := rd.Cards[0].Upended; top != (facing == "inward") {
+			t.Errorf("facing=%s has the top card upended %v", facing, top)
+		}
+		if want := map[string]int{"upright": 0, "inward": 6, "outward": 6}[facing]; upended != want {
+			t.Errorf("facing=%s upended %d cards, want %d", facing, upended, want)
+		}
+	}
+}
+
+func TestWheelDirection(t *testing.T) {
+	// starting at the top, clockwise goes right, and counter-clockwise left
+	for _, tt := range []struct {
+		dir   string
+		right bool
+	}{{"cw", true}, {"ccw", false}} {
+		spr, err := wheelSpread(wheelPreset{start: 90}, url.Values{"cards": {"4"}, "dir": {tt.dir}}, deckShape{0.7, 52})
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, next := spr.Positions[0], spr.Positions[1]
+		if top.Y >= next.Y || (next.X > top.X) != tt.right {
+			t.Errorf("dir=%s went from %g,%g to %g,%g", tt.dir, top.X, top.Y, next.X, next.Y)
+		}
+	}
+}
+
+func TestCurvedRow(t *testing.T) {
+	tests := []struct {
+		fan   bool
+		n     int
+		query string
+		sweep float64 // from the first card's rotation to the last; -1 when it fails
+	}{
+		{true, 5, "", 60},
+		{true, 7, "sweep=120", 120},
+		{true, 1, "", 0},
+		{false, 5, "", 0},
+		{false, 3, "sweep=30&radius=4", 0},
+		{true, 3, "sweep=400", -1},
+		{true, 3, "radius=-1", -1},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		spr, err := curvedRow(tt.fan, tt.n, params, 0.7)
+		if tt.sweep < 0 {
+			if err == nil {
+				t.Errorf("curvedRow(%v, %d, %q) succeeded, want an error", tt.fan, tt.n, tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("curvedRow(%v, %d, %q): %v", tt.fan, tt.n, tt.query, err)
+			continue
+		}
+		if len(spr.Positions) != tt.n {
+			t.Errorf("curvedRow(%v, %d, %q) has %d positions", tt.fan, tt.n, tt.query, len(spr.Positions))
+			continue
+		}
+
+		first, last := spr.Positions[0], spr.Positions[tt.n-1]
+		if got := first.Rotation - last.Rotation; math.Abs(got-tt.sweep) > 1e-9 {
+			t.Errorf("curvedRow(%v, %d, %q) turns %g from first to last, want %g", tt.fan, tt.n, tt.query, got, tt.sweep)
+		}
+		// the row is symmetric, left to right, and cropped close
+		if math.Abs(first.X-(spr.Width-last.X)) > 1e-9 || math.Abs(first.Y-last.Y) > 1e-9 {
+			t.Errorf("curvedRow(%v, %d, %q) is lopsided: %s", tt.fan, tt.n, tt.query, where(spr))
+		}
+		if tt.n > 2 && spr.Positions[tt.n/2].Y >= first.Y {
+			t.Errorf("curvedRow(%v, %d, %q) doesn't rise in the middle: %s", tt.fan, tt.n, tt.query, where(spr))
+		}
+	}
+}
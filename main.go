@@ -2,26 +2,44 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
-	"image"
-	"image/draw"
-	"image/jpeg"
+	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rwtodd/Go.AppUtil/resource"
 )
 
 var port = flag.String("port", "8000", "serve from this localhost port")
+var spreadDir = flag.String("spreads", "", "load additional spread definitions from this directory")
+var deckCacheSize = flag.Int("decks", 4, "keep up to this many decks open at once")
+var deckIdle = flag.Duration("idle", 10*time.Minute, "close decks unused for this long (0 keeps them open)")
+var readingsFile = flag.String("readings", "", "save readings to this file (by default they're kept in memory only)")
+var keepReadings = flag.Int("keep", 1000, "keep up to this many of the latest readings (0 keeps them all)")
 var help bool
 
-// rscLoc is the locator for our resources
+var errUnknownLayout = errors.New("unknown layout")
+
+// seedHeader echoes the seed of each reading, so that it can
+// be requested again.
+const seedHeader = "X-Carddiv-Seed"
+
+// readingHeader gives the ID each reading is saved under.
+const readingHeader = "X-Carddiv-Reading"
+
+// rscLoc is the locator for our resources, which it finds
+// in the rscPaths or the rscSub directory of the GOPATH.
 var rscBase resource.Locator
+var rscPaths = []string{"."}
+var rscSub = filepath.Join("github.com", "rwtodd", "carddiv", "ui")
 
 func main() {
 	var err error
@@ -34,18 +52,53 @@ func main() {
 		os.Exit(1)
 	}
 
-	rscBase = resource.NewPathLocator([]string{"."}, filepath.Join("github.com", "rwtodd", "carddiv", "ui"))
+	rscBase = resource.NewPathLocator(rscPaths, rscSub)
 
 	rand.Seed(time.Now().UnixNano())
 
+	// load the standard spreads, and then any private ones
+	spreads, err := rscBase.Path("spreads")
+	if err == nil {
+		err = loadSpreads(spreads)
+	}
+	if err == nil && *spreadDir != "" {
+		err = loadSpreads(*spreadDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.Arg(0) == "render" {
+		if err = renderCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	scanDecks()
+
+	savedReadings.limit = *keepReadings
+	if *readingsFile != "" {
+		if err = savedReadings.open(*readingsFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *deckIdle > 0 {
+		go sweepIdleDecks(*deckIdle)
+	}
+
 	http.HandleFunc("/", mainHandler)
 	http.HandleFunc("/carddiv/cdiv.css", cssHandler)
 	http.HandleFunc("/carddiv/cfg", cfgHandler)
+	http.HandleFunc("/carddiv/decks", decksHandler)
 
-	http.HandleFunc("/carddiv/row/", rowHandler)
-	http.HandleFunc("/carddiv/houses/", houseHandler)
-	http.HandleFunc("/carddiv/celtic/", celticHandler)
-	http.HandleFunc("/carddiv/tableau/", tableauHandler)
+	http.HandleFunc("/carddiv/", spreadHandler)
+	http.HandleFunc("/carddiv/reading/", readingHandler)
+	http.HandleFunc("/carddiv/pdf/", pdfHandler)
+	http.HandleFunc("/carddiv/r/", savedHandler)
+	http.HandleFunc("/carddiv/history", historyHandler)
+	http.HandleFunc("/history", historyPageHandler)
 
 	if err = http.ListenAndServe("localhost:"+*port, nil); err != nil {
 		log.Fatal(err)
@@ -68,6 +121,14 @@ func cssHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func historyPageHandler(w http.ResponseWriter, r *http.Request) {
+	if history, err := rscBase.Path("history.html"); err == nil {
+		http.ServeFile(w, r, history)
+	} else {
+		log.Fatal(err)
+	}
+}
+
 func cfgHandler(w http.ResponseWriter, r *http.Request) {
 	cfg, err := json.Marshal(configurations)
 	if err != nil {
@@ -76,6 +137,41 @@ func cfgHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(cfg)
 }
 
+// decksHandler lists the available decks, rescanning the
+// resource directories first if asked to refresh.
+func decksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("refresh") != "" {
+		scanDecks()
+	}
+	js, err := json.Marshal(deckCatalog())
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// historyHandler searches the saved readings, listing those
+// that match as JSON.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	hf, err := newHistoryFilter(r.URL.Query())
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	js, err := json.Marshal(savedReadings.search(hf))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
 func getOrElse(lst []string, def string) string {
 	if len(lst) > 0 {
 		def = lst[0]
@@ -83,344 +179,242 @@ func getOrElse(lst []string, def string) string {
 	return def
 }
 
-// tableauHandler generates an image of cards in a "Grand Tableau",
-// of 4 rows of 8 and 1 row of 4
-func tableauHandler(w http.ResponseWriter, r *http.Request) {
+// dealRequest does the work common to every handler that draws
+// a spread: it finds the named layout and the requested deck, and
+// deals out a reading.  The caller must Close the deck.
+func dealRequest(r *http.Request, name string) (*deck, *reading, error) {
 	if err := r.ParseForm(); err != nil {
 		log.Print(err)
 	}
 
-	desiredWidth, _ := strconv.Atoi(getOrElse(r.Form["width"], "600"))
-	desiredReversals, _ := strconv.Atoi(getOrElse(r.Form["rev"], "50"))
-	desiredDeck := getOrElse(r.Form["deck"], "Poker")
-	log.Printf("TABLEAU: %s Width: %d Reversals: %d%%",
-		desiredDeck,
-		desiredWidth,
-		desiredReversals)
-	revN := 1.0 - float64(desiredReversals)/100.0
-
-	deck, err := requestDeck(desiredDeck + ".zip")
+	defDeck, err := layoutDeck(name)
 	if err != nil {
-		log.Print(err)
-		return
+		return nil, nil, err
 	}
-	defer deck.Close()
-
-	cardWidth := int(float64(desiredWidth) / 8.0)
-	cardHeight := deck.CardHeight(cardWidth)
-
-	// now, shuffle the deck
-	selected, err := deck.Shuffled(36)
+	if defDeck == "" {
+		defDeck = "Lenormand"
+	}
+	deck, err := requestDeck(getOrElse(r.Form["deck"], defDeck))
 	if err != nil {
-		log.Print(err)
-		return
+		return nil, nil, err
 	}
 
-	// now, create the image
-	actualWidth := int(8.0 * float64(cardWidth))
-	actualHeight := int(5.0 * float64(cardHeight))
-	answer := image.NewRGBA(image.Rect(0, 0, actualWidth, actualHeight))
-
-	for idx, row := range [][]int{selected[:8],
-		selected[8:16],
-		selected[16:24],
-		selected[24:32],
-		selected[32:]} {
-		yloc := idx * cardHeight
-		for pos, c := range row {
-			xloc := pos * cardWidth
-			if idx == 4 {
-				xloc += (2 * cardWidth)
-			}
-
-			cardRect := image.Rect(xloc, yloc, xloc+cardWidth, yloc+cardHeight)
-
-			// open the card...
-			var co cardOpts
-			if rand.Float64() >= revN {
-				co.reversed = true
-			}
-			cardImg, err := deck.Image(c, cardWidth, co)
-			if err != nil {
-				log.Print(err)
-				cardImg = image.Black
-			}
-
-			draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-		}
+	spr, err := layoutSpread(name, r.Form, deck.shape())
+	if err != nil {
+		deck.Close()
+		return nil, nil, err
 	}
-
-	err = jpeg.Encode(w, answer, &jpeg.Options{Quality: 80})
+	rd, err := dealSpread(spr, name, r.Form, deck)
 	if err != nil {
+		deck.Close()
+		return nil, nil, err
+	}
+
+	// a reading that can't be saved can still be shown
+	if err = savedReadings.save(rd); err != nil {
 		log.Print(err)
 	}
+	return deck, rd, nil
 }
 
-// rowHandler generates an image of cards in a row, with optional
-// overlap.
-func rowHandler(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		log.Print(err)
+// dealError reports a failure from dealRequest to the client.
+func dealError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == errUnknownLayout {
+		http.NotFound(w, r)
+		return
 	}
+	log.Print(err)
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// layoutName pulls the layout name from the end of a URL path.
+func layoutName(path, prefix string) string {
+	return strings.Trim(strings.TrimPrefix(path, prefix), "/")
+}
 
-	desiredWidth, _ := strconv.Atoi(getOrElse(r.Form["width"], "600"))
-	desiredCards, _ := strconv.Atoi(getOrElse(r.Form["cards"], "3"))
-	desiredShowing, _ := strconv.Atoi(getOrElse(r.Form["pct"], "100"))
-	desiredReversals, _ := strconv.Atoi(getOrElse(r.Form["rev"], "50"))
-	desiredDeck := getOrElse(r.Form["deck"], "Lenormand")
-	log.Printf("ROW: %s Cards: %d  Width: %d  Showing: %d%% Reversals: %d%%",
-		desiredDeck,
-		desiredCards,
-		desiredWidth,
-		desiredShowing,
-		desiredReversals)
-	revN := 1.0 - float64(desiredReversals)/100.0
-
-	deck, err := requestDeck(desiredDeck + ".zip")
+// spreadHandler generates an image of cards in any of the
+// registered layouts, named by the last part of the URL.
+func spreadHandler(w http.ResponseWriter, r *http.Request) {
+	oo, err := newImageOpts(r)
 	if err != nil {
-		log.Print(err)
+		dealError(w, r, err)
+		return
+	}
+	deck, rd, err := dealRequest(r, layoutName(r.URL.Path, "/carddiv/"))
+	if err != nil {
+		dealError(w, r, err)
 		return
 	}
 	defer deck.Close()
+	writeImage(w, deck, rd, oo)
+}
 
-	// to account for overlap, we figure out the number of
-	// cards effectively showing.  Thus 3 cards showing at 100%
-	// would be 1 + 1 + 1, while at 80% it would be .8 + .8 + 1
-	// (since the last card is fully visible)
-	showPct := float64(desiredShowing) / 100.0
-	effectiveCards := 1.0 + float64(desiredCards-1)*showPct
-	cardWidth := int(float64(desiredWidth) / effectiveCards)
-	cardHeight := deck.CardHeight(cardWidth)
-	showingWidth := int(float64(cardWidth) * showPct)
-
-	// now, shuffle the deck
-	selected, err := deck.Shuffled(desiredCards)
+// readingHandler deals a spread like spreadHandler, but describes
+// the cards drawn as JSON rather than drawing them.
+func readingHandler(w http.ResponseWriter, r *http.Request) {
+	deck, rd, err := dealRequest(r, layoutName(r.URL.Path, "/carddiv/reading/"))
 	if err != nil {
-		log.Print(err)
+		dealError(w, r, err)
 		return
 	}
+	defer deck.Close()
+	writeJSON(w, rd)
+}
 
-	// now, create the image
-	actualWidth := int(effectiveCards * float64(cardWidth))
-	answer := image.NewRGBA(image.Rect(0, 0, actualWidth, cardHeight))
-	for idx, c := range selected {
-		xloc := idx * showingWidth
-		cardRect := image.Rect(xloc, 0, xloc+cardWidth, cardHeight)
-
-		// open the card...
-		var co cardOpts
-		if rand.Float64() >= revN {
-			co.reversed = true
-		}
-		cardImg, err := deck.Image(c, cardWidth, co)
-		if err != nil {
-			log.Print(err)
-			cardImg = image.Black
-		}
-
-		draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
+// pdfHandler deals a spread like spreadHandler, but lays it out
+// on a printable page.
+func pdfHandler(w http.ResponseWriter, r *http.Request) {
+	oo, err := newPrintOpts(r)
+	if err != nil {
+		dealError(w, r, err)
+		return
 	}
-	err = jpeg.Encode(w, answer, &jpeg.Options{Quality: 80})
+	deck, rd, err := dealRequest(r, layoutName(r.URL.Path, "/carddiv/pdf/"))
 	if err != nil {
-		log.Print(err)
+		dealError(w, r, err)
+		return
 	}
+	defer deck.Close()
+	writePDF(w, deck, rd, oo)
 }
 
-// celticHandler generates an image of cards in a celtic cross.
-func celticHandler(w http.ResponseWriter, r *http.Request) {
+// savedHandler serves a saved reading by its ID: as an image,
+// or as JSON or a PDF when the ID ends in .json or .pdf.  Since
+// reveal and facedown work here too, the same link can be sent
+// again with more of the cards turned up.
+func savedHandler(w http.ResponseWriter, r *http.Request) {
+	id := layoutName(r.URL.Path, "/carddiv/r/")
+	ext := path.Ext(id)
+	rd, ok := savedReadings.lookup(strings.TrimSuffix(id, ext))
+	if !ok || (ext != "" && ext != ".json" && ext != ".pdf") {
+		http.NotFound(w, r)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
 		log.Print(err)
 	}
+	if err := rd.turnCards(r.Form); err != nil {
+		dealError(w, r, err)
+		return
+	}
+	if ext == ".json" {
+		writeJSON(w, rd)
+		return
+	}
 
-	desiredWidth, _ := strconv.Atoi(getOrElse(r.Form["width"], "600"))
-	desiredReversals, _ := strconv.Atoi(getOrElse(r.Form["rev"], "50"))
-	desiredDeck := getOrElse(r.Form["deck"], "Lenormand")
-	log.Printf("CELTIC: %s Width: %d Reversals: %d%%",
-		desiredDeck,
-		desiredWidth,
-		desiredReversals)
-	revN := 1.0 - float64(desiredReversals)/100.0
-
-	deck, err := requestDeck(desiredDeck + ".zip")
+	var oo *outputOpts
+	var err error
+	if ext == ".pdf" {
+		oo, err = newPrintOpts(r)
+	} else {
+		oo, err = newImageOpts(r)
+	}
 	if err != nil {
-		log.Print(err)
+		dealError(w, r, err)
 		return
 	}
-	defer deck.Close()
-
-	// the overall image is 7 cards wide and 4 tall:
-	//  0123456
-	// |  x   x|
-	// |x x x x|   the "cross" part is lowered by
-	// |  x   x|   half a card, relative to this pic.
-	// |      x|
-	cardWidth := int(float64(desiredWidth) / 7.0)
-	cardSize := image.Point{cardWidth, deck.CardHeight(cardWidth)}
-
-	// now, shuffle the deck
-	selected, err := deck.Shuffled(10)
+	deck, err := savedDeck(rd)
 	if err != nil {
 		log.Print(err)
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	defer deck.Close()
+	if ext == ".pdf" {
+		writePDF(w, deck, rd, oo)
 		return
 	}
 
-	// now, create the image
-	actualWidth := 7 * cardSize.X
-	actualHeight := 4 * cardSize.Y
-	answer := image.NewRGBA(image.Rect(0, 0, actualWidth, actualHeight))
-
-	// nested helper function to create the card images
-	getImage := func(which int, side bool) image.Image {
-		var co cardOpts
-		if rand.Float64() >= revN {
-			co.reversed = true
-		}
-		co.onSide = side
-		img, err := deck.Image(selected[which], cardWidth, co)
-		if err != nil {
-			log.Print(err)
-			img = image.Black
-		}
-		return img
-	}
-
-	// draw the cross...
-	// 1. middle
-	cardImg := getImage(0, false)
-	midCard := image.Point{(actualWidth - 2*cardSize.X) / 2,
-		(actualHeight - cardSize.Y) / 2}
-	cardRect := image.Rectangle{midCard, midCard.Add(cardSize)}
-	draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-
-	// 2. crosses it
-	cardImg = getImage(1, true)
-	cardLoc := image.Point{(actualWidth - cardSize.X - cardSize.Y) / 2,
-		(actualHeight - cardSize.X) / 2}
-	cardRect = image.Rectangle{cardLoc,
-		cardLoc.Add(image.Pt(cardSize.Y, cardSize.X))}
-	draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-
-	// 3. below it
-	cardImg = getImage(2, false)
-	cardLoc = midCard.Add(image.Pt(0, cardSize.Y+cardSize.Y/3))
-	cardRect = image.Rectangle{cardLoc, cardLoc.Add(cardSize)}
-	draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-
-	// 4. Waning Influence
-	cardImg = getImage(3, false)
-	cardLoc = midCard.Sub(image.Pt(cardSize.X*2, 0))
-	cardRect = image.Rectangle{cardLoc, cardLoc.Add(cardSize)}
-	draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-
-	// 5. New Energy
-	cardImg = getImage(4, false)
-	cardLoc = midCard.Sub(image.Pt(0, cardSize.Y+cardSize.Y/3))
-	cardRect = image.Rectangle{cardLoc, cardLoc.Add(cardSize)}
-	draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-
-	// 6. Waxing Influence
-	cardImg = getImage(5, false)
-	cardLoc = midCard.Add(image.Pt(cardSize.X*2, 0))
-	cardRect = image.Rectangle{cardLoc, cardLoc.Add(cardSize)}
-	draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-
-	// 7 through 10...
-	cardLoc = image.Point{cardSize.X * 6, cardSize.Y * 3}
-	for idx := 6; idx < 10; idx++ {
-		cardImg = getImage(idx, false)
-		cardRect = image.Rectangle{cardLoc, cardLoc.Add(cardSize)}
-		draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
-		cardLoc = cardLoc.Sub(image.Pt(0, cardSize.Y))
-	}
-
-	err = jpeg.Encode(w, answer, &jpeg.Options{Quality: 80})
-	if err != nil {
-		log.Print(err)
+	// a width draws the reading at another size, for thumbnails
+	if width, _ := strconv.Atoi(r.Form.Get("width")); width > 0 && width != rd.Width {
+		rd = rd.scaled(width)
 	}
+	writeImage(w, deck, rd, oo)
 }
 
-// houseHandler generates an image of cards around the astrological houses
-func houseHandler(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		log.Print(err)
+// readingHeaders describe the reading being sent back, so that
+// it can be requested again.
+func readingHeaders(w http.ResponseWriter, rd *reading) {
+	w.Header().Set(seedHeader, strconv.FormatInt(rd.Seed, 10))
+	if rd.ID != "" {
+		w.Header().Set(readingHeader, rd.ID)
 	}
+}
 
-	desiredWidth, _ := strconv.Atoi(getOrElse(r.Form["width"], "600"))
-	desiredReversals, _ := strconv.Atoi(getOrElse(r.Form["rev"], "50"))
-	desiredDeck := getOrElse(r.Form["deck"], "Lenormand")
-	log.Printf("HOUSES: %s Width: %d Reversals: %d%%",
-		desiredDeck,
-		desiredWidth,
-		desiredReversals)
-	revN := 1.0 - float64(desiredReversals)/100.0
+// outputOpts are the choices for writing out a reading.  They are
+// read from the request before the reading is dealt, so that a bad
+// request is turned away before its reading is saved.
+type outputOpts struct {
+	enc *encoder // for an image
+	po  *pdfOpts // for a PDF
+	ro  *renderOpts
+}
 
-	deck, err := requestDeck(desiredDeck + ".zip")
+// newImageOpts reads the choices for drawing an image.
+func newImageOpts(r *http.Request) (*outputOpts, error) {
+	quality, err := parseQuality(r.FormValue("quality"))
 	if err != nil {
-		log.Print(err)
-		return
+		return nil, err
 	}
-	defer deck.Close()
-
-	// the overall image is 7 cards wide and 4 tall:
-	//  0123456
-	// |   a   |
-	// |  b 9  |
-	// | c   8 |
-	// |1     7|
-	// | 2   6 |
-	// |  3 5  |
-	// |   4   |
-	cardWidth := int(float64(desiredWidth) / 7.0)
-	cardSize := image.Point{cardWidth, deck.CardHeight(cardWidth)}
-	halfHeight := cardSize.Y / 2
-	design := []image.Point{image.Pt(0, 3*halfHeight),
-		image.Pt(cardSize.X, 4*halfHeight),
-		image.Pt(2*cardSize.X, 5*halfHeight),
-		image.Pt(3*cardSize.X, 6*halfHeight),
-		image.Pt(4*cardSize.X, 5*halfHeight),
-		image.Pt(5*cardSize.X, 4*halfHeight),
-		image.Pt(6*cardSize.X, 3*halfHeight),
-		image.Pt(5*cardSize.X, 2*halfHeight),
-		image.Pt(4*cardSize.X, halfHeight),
-		image.Pt(3*cardSize.X, 0),
-		image.Pt(2*cardSize.X, halfHeight),
-		image.Pt(1*cardSize.X, 2*halfHeight)}
-
-	// now, shuffle the deck
-	selected, err := deck.Shuffled(12)
+	enc, err := newEncoder(r.FormValue("format"), quality)
 	if err != nil {
-		log.Print(err)
-		return
+		return nil, err
 	}
+	ro, err := newRenderOpts(r.Form)
+	if err != nil {
+		return nil, err
+	}
+	return &outputOpts{enc: enc, ro: ro}, nil
+}
 
-	// now, create the image
-	actualWidth := 7 * cardSize.X
-	actualHeight := 4 * cardSize.Y
-	answer := image.NewRGBA(image.Rect(0, 0, actualWidth, actualHeight))
-
-	// nested helper function to create the card images
-	getImage := func(which int) image.Image {
-		var co cardOpts
-		if rand.Float64() >= revN {
-			co.reversed = true
-		}
-		co.onSide = false
-		img, err := deck.Image(selected[which], cardWidth, co)
-		if err != nil {
-			log.Print(err)
-			img = image.Black
-		}
-		return img
+// newPrintOpts reads the choices for printing a PDF.
+func newPrintOpts(r *http.Request) (*outputOpts, error) {
+	dpi, _ := strconv.ParseFloat(r.FormValue("dpi"), 64)
+	po, err := newPDFOpts(r.Form.Get("paper"), r.Form.Get("orient"), r.Form.Get("captions"), dpi)
+	if err != nil {
+		return nil, err
+	}
+	ro, err := newRenderOpts(r.Form)
+	if err != nil {
+		return nil, err
 	}
+	return &outputOpts{po: po, ro: ro}, nil
+}
 
-	for idx, v := range design {
-		cardImg := getImage(idx)
-		cardRect := image.Rectangle{v, v.Add(cardSize)}
-		draw.Draw(answer, cardRect, cardImg, image.ZP, draw.Src)
+// writeImage draws the reading, in the format asked for.
+func writeImage(w http.ResponseWriter, deck *deck, rd *reading, oo *outputOpts) {
+	w.Header().Set("Content-Type", oo.enc.contentType)
+	readingHeaders(w, rd)
+	if err := oo.enc.encode(w, rd.render(deck, oo.ro)); err != nil {
+		log.Print(err)
 	}
+}
 
-	err = jpeg.Encode(w, answer, &jpeg.Options{Quality: 80})
+// writeJSON describes the reading as JSON, keeping face-down
+// cards hidden.
+func writeJSON(w http.ResponseWriter, rd *reading) {
+	js, err := json.Marshal(rd.concealed())
 	if err != nil {
 		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	readingHeaders(w, rd)
+	w.Write(js)
+}
+
+// writePDF lays the reading out on a printable page.
+func writePDF(w http.ResponseWriter, deck *deck, rd *reading, oo *outputOpts) {
+	fname := rd.Layout
+	if rd.ID != "" {
+		fname = rd.ID
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", fname+".pdf"))
+	readingHeaders(w, rd)
+	if err := rd.writePDF(w, deck, oo.ro, oo.po); err != nil {
+		log.Print(err)
 	}
 }
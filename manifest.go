@@ -0,0 +1,116 @@
+package main
+
+// an optional deck.json in the deck describes the deck:
+// its title, and the name, number, suit and meanings of
+// each card.  The order of the cards in the manifest becomes
+// the order of the deck, with any images the manifest doesn't
+// mention following along in stored order.
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+const manifestName = "deck.json"
+
+// cardInfo describes a single card.
+type cardInfo struct {
+	File     string `json:"file"`
+	Name     string `json:"name,omitempty"`
+	Number   *int   `json:"number,omitempty"`
+	Suit     string `json:"suit,omitempty"`
+	Arcana   string `json:"arcana,omitempty"`
+	Upright  string `json:"upright,omitempty"`
+	Reversed string `json:"reversed,omitempty"`
+}
+
+type manifest struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Back        string     `json:"back,omitempty"`
+	Cards       []cardInfo `json:"cards"`
+}
+
+// isManifest tells if a file in the deck is the manifest.
+func isManifest(sf storeFile) bool {
+	return strings.ToLower(path.Base(sf.Name())) == manifestName
+}
+
+func readManifest(sf storeFile) (*manifest, error) {
+	rdr, err := sf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	var m manifest
+	if err = json.NewDecoder(rdr).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// defaultInfo makes up a description for a card the manifest
+// doesn't cover, naming it after its file.
+func defaultInfo(fname string) cardInfo {
+	base := path.Base(fname)
+	return cardInfo{File: fname, Name: strings.TrimSuffix(base, path.Ext(base))}
+}
+
+// backNames are the conventional names for the card back,
+// when the manifest doesn't give one.
+var backNames = []string{"back", "cardback", "card-back", "card_back"}
+
+// findBack gives the index of the card back among the images,
+// or -1 if there isn't one.
+func (m *manifest) findBack(imgs []storeFile) int {
+	for idx, sf := range imgs {
+		base := path.Base(sf.Name())
+		if m.Back != "" {
+			if sf.Name() == m.Back || base == m.Back {
+				return idx
+			}
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(base, path.Ext(base)))
+		for _, bn := range backNames {
+			if stem == bn {
+				return idx
+			}
+		}
+	}
+	return -1
+}
+
+// arrange puts the images into the order given by the manifest,
+// and describes each of them.  Manifest entries can name a file by
+// its full path in the deck, or just its base name.
+func (m *manifest) arrange(imgs []storeFile) ([]storeFile, []cardInfo) {
+	ordered := make([]storeFile, 0, len(imgs))
+	infos := make([]cardInfo, 0, len(imgs))
+	used := make([]bool, len(imgs))
+
+	for _, ci := range m.Cards {
+		for idx, zf := range imgs {
+			if !used[idx] && (zf.Name() == ci.File || path.Base(zf.Name()) == ci.File) {
+				used[idx] = true
+				ci.File = zf.Name()
+				if ci.Name == "" {
+					ci.Name = defaultInfo(zf.Name()).Name
+				}
+				ordered = append(ordered, zf)
+				infos = append(infos, ci)
+				break
+			}
+		}
+	}
+
+	for idx, zf := range imgs {
+		if !used[idx] {
+			ordered = append(ordered, zf)
+			infos = append(infos, defaultInfo(zf.Name()))
+		}
+	}
+	return ordered, infos
+}
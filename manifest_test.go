@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArrange(t *testing.T) {
+	imgs := []storeFile{
+		memFile{name: "major/00-fool.jpg"},
+		memFile{name: "major/01-magician.jpg"},
+		memFile{name: "minor/ace-wands.jpg"},
+	}
+	tests := []struct {
+		cards []cardInfo
+		files string // the files in order
+		names string // the names in order
+	}{
+		// no manifest entries: stored order, named after the files
+		{nil,
+			"major/00-fool.jpg major/01-magician.jpg minor/ace-wands.jpg",
+			"00-fool|01-magician|ace-wands"},
+		// by base name, with the rest following
+		{[]cardInfo{{File: "ace-wands.jpg", Name: "Ace of Wands"}},
+			"minor/ace-wands.jpg major/00-fool.jpg major/01-magician.jpg",
+			"Ace of Wands|00-fool|01-magician"},
+		// by full path, without a name
+		{[]cardInfo{{File: "major/01-magician.jpg"}, {File: "major/00-fool.jpg", Name: "The Fool"}},
+			"major/01-magician.jpg major/00-fool.jpg minor/ace-wands.jpg",
+			"01-magician|The Fool|ace-wands"},
+		// entries naming no image, or one already used, are skipped
+		{[]cardInfo{{File: "missing.jpg", Name: "Missing"}, {File: "00-fool.jpg"}, {File: "00-fool.jpg", Name: "Again"}},
+			"major/00-fool.jpg major/01-magician.jpg minor/ace-wands.jpg",
+			"00-fool|01-magician|ace-wands"},
+	}
+	for _, tt := range tests {
+		m := &manifest{Cards: tt.cards}
+		ordered, infos := m.arrange(imgs)
+		var files, names []string
+		for idx, sf := range ordered {
+			files = append(files, sf.Name())
+			names = append(names, infos[idx].Name)
+			if infos[idx].File != sf.Name() {
+				t.Errorf("card %d has file %q, but image %q", idx, infos[idx].File, sf.Name())
+			}
+		}
+		if got := strings.Join(files, " "); got != tt.files {
+			t.Errorf("arrange(%v) put the files in order %q, want %q", tt.cards, got, tt.files)
+		}
+		if got := strings.Join(names, "|"); got != tt.names {
+			t.Errorf("arrange(%v) named the cards %q, want %q", tt.cards, got, tt.names)
+		}
+	}
+}
+
+func TestFindBack(t *testing.T) {
+	imgs := []storeFile{
+		memFile{name: "cards/01.jpg"},
+		memFile{name: "cards/Back.png"},
+		memFile{name: "cards/reverse.png"},
+	}
+	tests := []struct {
+		back string
+		want int
+	}{
+		{"", 1},
+		{"reverse.png", 2},
+		{"cards/reverse.png", 2},
+		{"nothing.png", -1},
+	}
+	for _, tt := range tests {
+		m := &manifest{Back: tt.back}
+		if got := m.findBack(imgs); got != tt.want {
+			t.Errorf("findBack with back %q = %d, want %d", tt.back, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+// the output formats we can produce for a reading's image.
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const defaultQuality = 80
+
+// an encoder writes images in one format.
+type encoder struct {
+	contentType string
+	encode      func(w io.Writer, img image.Image) error
+}
+
+// parseQuality reads the quality parameter, which is left at
+// the default when it isn't given.
+func parseQuality(s string) (int, error) {
+	if s == "" {
+		return defaultQuality, nil
+	}
+	quality, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad quality %q", s)
+	}
+	return quality, nil
+}
+
+// newEncoder gives an encoder for the named format.  The quality
+// only matters for JPEG, where it runs from 1 to 100.  PNG output
+// is lossless, and keeps the background transparent wherever no
+// card is drawn.
+func newEncoder(format string, quality int) (*encoder, error) {
+	switch strings.ToLower(format) {
+	case "", "jpg", "jpeg":
+		if quality < 1 || quality > 100 {
+			return nil, fmt.Errorf("JPEG quality %d is not between 1 and 100", quality)
+		}
+		return &encoder{"image/jpeg", func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		}}, nil
+	case "png":
+		return &encoder{"image/png", png.Encode}, nil
+	}
+	return nil, fmt.Errorf("unknown image format %q", format)
+}
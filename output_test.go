@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		format      string
+		quality     int
+		contentType string // empty when it fails
+	}{
+		{"", 80, "image/jpeg"},
+		{"jpg", 1, "image/jpeg"},
+		{"JPEG", 100, "image/jpeg"},
+		{"png", 0, "image/png"},
+		{"PNG", 500, "image/png"},
+		{"jpeg", 0, ""},
+		{"jpeg", 101, ""},
+		{"webp", 80, ""},
+		{"gif", 80, ""},
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.NRGBA{0xff, 0, 0, 0xff})
+	for _, tt := range tests {
+		enc, err := newEncoder(tt.format, tt.quality)
+		if tt.contentType == "" {
+			if err == nil {
+				t.Errorf("newEncoder(%q, %d) succeeded, want an error", tt.format, tt.quality)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newEncoder(%q, %d): %v", tt.format, tt.quality, err)
+			continue
+		}
+		if enc.contentType != tt.contentType {
+			t.Errorf("newEncoder(%q, %d) writes %s, want %s", tt.format, tt.quality, enc.contentType, tt.contentType)
+		}
+
+		// what it writes has to decode as the format it claims
+		var buf bytes.Buffer
+		if err := enc.encode(&buf, img); err != nil {
+			t.Errorf("encoding with %q: %v", tt.format, err)
+			continue
+		}
+		got, format, err := image.Decode(&buf)
+		if err != nil || "image/"+format != tt.contentType || got.Bounds() != img.Bounds() {
+			t.Errorf("encoding with %q gave a %s image of %v (%v)", tt.format, format, got.Bounds(), err)
+		}
+	}
+
+	// PNG keeps the background transparent
+	enc, _ := newEncoder("png", 0)
+	var buf bytes.Buffer
+	enc.encode(&buf, img)
+	got, _, _ := image.Decode(&buf)
+	if _, _, _, a := got.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("PNG gave an alpha of %d for a transparent pixel", a)
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		s       string
+		quality int
+		fails   bool
+	}{
+		{"", defaultQuality, false},
+		{"90", 90, false},
+		{"0", 0, false}, // newEncoder turns this away, for JPEG
+		{"high", 0, true},
+		{"9.5", 0, true},
+		{" 90", 0, true},
+	}
+	for _, tt := range tests {
+		quality, err := parseQuality(tt.s)
+		switch {
+		case tt.fails && err == nil:
+			t.Errorf("parseQuality(%q) = %d, want an error", tt.s, quality)
+		case !tt.fails && err != nil:
+			t.Errorf("parseQuality(%q): %v", tt.s, err)
+		case quality != tt.quality:
+			t.Errorf("parseQuality(%q) = %d, want %d", tt.s, quality, tt.quality)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+// a minimal PDF writer, just capable enough to print a reading.
+// Rather than embedding the screen-sized image, each card's own
+// image is placed on the page, so prints get the full resolution
+// of the scans.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+// paper sizes, in points (portrait)
+var paperSizes = map[string][2]float64{
+	"letter":  {612, 792},
+	"legal":   {612, 1008},
+	"tabloid": {792, 1224},
+	"a3":      {842, 1191},
+	"a4":      {595, 842},
+	"a5":      {420, 595},
+}
+
+const pdfMargin = 36.0 // half an inch all around
+
+// pdfOpts are the choices for printing a reading.
+type pdfOpts struct {
+	paper     string
+	landscape bool
+	auto      bool    // turn the page to suit the reading
+	dpi       float64 // zero means scale to fit the page
+	positions bool    // caption cards with their position
+	names     bool    // caption cards with their name
+}
+
+// newPDFOpts interprets the request parameters for a PDF.
+func newPDFOpts(paper, orient, captions string, dpi float64) (*pdfOpts, error) {
+	po := &pdfOpts{paper: strings.ToLower(paper), dpi: dpi}
+	if po.paper == "" {
+		po.paper = "letter"
+	}
+	if _, ok := paperSizes[po.paper]; !ok {
+		return nil, fmt.Errorf("unknown paper size %q", paper)
+	}
+	if dpi < 0 {
+		return nil, fmt.Errorf("bad dpi %g", dpi)
+	}
+
+	switch strings.ToLower(orient) {
+	case "", "auto":
+		po.auto = true
+	case "portrait":
+	case "landscape":
+		po.landscape = true
+	default:
+		return nil, fmt.Errorf("unknown orientation %q", orient)
+	}
+
+	switch strings.ToLower(captions) {
+	case "", "none":
+	case "position":
+		po.positions = true
+	case "name":
+		po.names = true
+	case "both":
+		po.positions, po.names = true, true
+	default:
+		return nil, fmt.Errorf("unknown captions %q", captions)
+	}
+	return po, nil
+}
+
+// pdfDoc collects numbered PDF objects, and writes them out
+// with the cross-reference table at the end.
+type pdfDoc struct {
+	objs [][]byte
+}
+
+// add appends an object, giving its number.
+func (pd *pdfDoc) add(body []byte) int {
+	pd.objs = append(pd.objs, body)
+	return len(pd.objs)
+}
+
+// set fills in an object added earlier.
+func (pd *pdfDoc) set(num int, body []byte) { pd.objs[num-1] = body }
+
+func pdfStream(dict string, data []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream")
+	return buf.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// WriteTo writes the document, with object 1 as the catalog.
+func (pd *pdfDoc) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(pd.objs))
+	for idx, body := range pd.objs {
+		offsets[idx] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", idx+1)
+		buf.Write(body)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(pd.objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(pd.objs)+1, xref)
+
+	return buf.WriteTo(w)
+}
+
+// addImage embeds a card image.  Ordinary JPEGs go in exactly as
+// they are stored in the deck; anything else is decoded and
+// compressed, with a soft mask if it has any transparency.
+func (pd *pdfDoc) addImage(data []byte) (int, error) {
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(data)); err == nil {
+		switch cfg.ColorModel {
+		case color.YCbCrModel, color.RGBAModel:
+			return pd.add(pdfStream(fmt.Sprintf(
+				"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode",
+				cfg.Width, cfg.Height), data)), nil
+		case color.GrayModel:
+			return pd.add(pdfStream(fmt.Sprintf(
+				"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode",
+				cfg.Width, cfg.Height), data)), nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	b := img.Bounds()
+	rgb := make([]byte, 0, 3*b.Dx()*b.Dy())
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+
+	mask := ""
+	if !opaque {
+		num := pd.add(pdfStream(fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+			b.Dx(), b.Dy()), deflate(alpha)))
+		mask = fmt.Sprintf(" /SMask %d 0 R", num)
+	}
+	return pd.add(pdfStream(fmt.Sprintf(
+		"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode%s",
+		b.Dx(), b.Dy(), mask), deflate(rgb))), nil
+}
+
+// pdfRoundedRect gives the path of a rectangle with rounded
+// corners, drawing each corner as a bezier curve.
+func pdfRoundedRect(x, y, w, h, r float64) string {
+	if r <= 0 {
+		return fmt.Sprintf("%.3f %.3f %.3f %.3f re", x, y, w, h)
+	}
+	k := r * 0.5523 // control point distance for a quarter circle
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%.3f %.3f m ", x+r, y)
+	fmt.Fprintf(&sb, "%.3f %.3f l ", x+w-r, y)
+	fmt.Fprintf(&sb, "%.3f %.3f %.3f %.3f %.3f %.3f c ", x+w-r+k, y, x+w, y+r-k, x+w, y+r)
+	fmt.Fprintf(&sb, "%.3f %.3f l ", x+w, y+h-r)
+	fmt.Fprintf(&sb, "%.3f %.3f %.3f %.3f %.3f %.3f c ", x+w, y+h-r+k, x+w-r+k, y+h, x+w-r, y+h)
+	fmt.Fprintf(&sb, "%.3f %.3f l ", x+r, y+h)
+	fmt.Fprintf(&sb, "%.3f %.3f %.3f %.3f %.3f %.3f c ", x+r-k, y+h, x, y+h-r+k, x, y+h-r)
+	fmt.Fprintf(&sb, "%.3f %.3f l ", x, y+r)
+	fmt.Fprintf(&sb, "%.3f %.3f %.3f %.3f %.3f %.3f c h", x, y+r-k, x+r-k, y, x+r, y)
+	return sb.String()
+}
+
+// pdfImageName names the XObject for a card, or the card back.
+func pdfImageName(which int) string {
+	if which == backCard {
+		return "Back"
+	}
+	return fmt.Sprintf("Im%d", which)
+}
+
+// pdfColor gives the operands for setting a color.
+func pdfColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+}
+
+// helveticaWidths gives the widths of ASCII 32 through 126 in
+// Helvetica, in thousandths of the font size.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// pdfText makes a string safe for a PDF literal, replacing what
+// the standard fonts can't show, and measures its width at the
+// given font size.
+func pdfText(s string, size float64) (string, float64) {
+	var buf bytes.Buffer
+	width := 0
+	for _, r := range s {
+		if r < 32 || r > 126 {
+			r = '?'
+		}
+		if r == '(' || r == ')' || r == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+		width += helveticaWidths[r-32]
+	}
+	return buf.String(), float64(width) * size / 1000.0
+}
+
+// writePDF lays the reading out on a single page, with each card
+// embedded at its native resolution.
+func (rd *reading) writePDF(w io.Writer, dk *deck, ro *renderOpts, po *pdfOpts) error {
+	paper := paperSizes[po.paper]
+	pageW, pageH := paper[0], paper[1]
+	if po.landscape || po.auto && rd.Width > rd.Height {
+		pageW, pageH = pageH, pageW
+	}
+
+	lines := 0
+	if po.positions {
+		lines++
+	}
+	if po.names {
+		lines++
+	}
+
+	// find the scale from pixels to points: either as given by
+	// the dpi, or as large as will fit.  Either way, shrink to fit
+	// the page, leaving room for the captions under the bottom row.
+	const maxFont = 10.0
+	availW := pageW - 2*pdfMargin
+	availH := pageH - 2*pdfMargin - float64(lines)*maxFont*1.2
+	scale := math.Min(availW/float64(rd.Width), availH/float64(rd.Height))
+	if po.dpi > 0 {
+		scale = math.Min(scale, 72.0/po.dpi)
+	}
+	fontSize := math.Max(5.0, math.Min(maxFont, float64(rd.CardWidth)*scale/9.0))
+
+	offX := (pageW - float64(rd.Width)*scale) / 2.0
+	offY := (pageH - float64(rd.Height)*scale - float64(lines)*fontSize*1.2) / 2.0
+
+	pd := &pdfDoc{}
+	catalog := pd.add(nil)
+	pages := pd.add(nil)
+	page := pd.add(nil)
+	font := pd.add([]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"))
+
+	// embed each card image once, showing the card back
+	// for face-down cards
+	images := make(map[int]int)
+	var content, xobjs bytes.Buffer
+	for _, dc := range rd.Cards {
+		which := dc.Index
+		if dc.FaceDown {
+			which = backCard
+		}
+		if _, ok := images[which]; ok || (which == backCard && !dk.HasBack()) {
+			continue
+		}
+		data, err := dk.CardData(which)
+		if err != nil {
+			return err
+		}
+		num, err := pd.addImage(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", dc.File, err)
+		}
+		images[which] = num
+		fmt.Fprintf(&xobjs, " /%s %d 0 R", pdfImageName(which), num)
+	}
+
+	// lay the background down under the spread, tiling the
+	// texture from the top left as the image does
+	bgW, bgH := float64(rd.Width)*scale, float64(rd.Height)*scale
+	bgX, bgY := offX, pageH-offY-bgH
+	if ro.texture != nil {
+		var tex bytes.Buffer
+		if err := png.Encode(&tex, ro.texture); err != nil {
+			return err
+		}
+		num, err := pd.addImage(tex.Bytes())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&xobjs, " /Texture %d 0 R", num)
+
+		tb := ro.texture.Bounds()
+		tw, th := float64(tb.Dx())*scale, float64(tb.Dy())*scale
+		fmt.Fprintf(&content, "q %.3f %.3f %.3f %.3f re W n\n", bgX, bgY, bgW, bgH)
+		for y := 0.0; y < bgH; y += th {
+			for x := 0.0; x < bgW; x += tw {
+				fmt.Fprintf(&content, "q %.3f 0 0 %.3f %.3f %.3f cm /Texture Do Q\n",
+					tw, th, bgX+x, bgY+bgH-y-th)
+			}
+		}
+		content.WriteString("Q\n")
+	} else if _, _, _, a := ro.background.RGBA(); a > 0 {
+		fmt.Fprintf(&content, "q %s rg %.3f %.3f %.3f %.3f re f Q\n",
+			pdfColor(ro.background), bgX, bgY, bgW, bgH)
+	}
+
+	for _, dc := range rd.Cards {
+		left := offX + float64(dc.Rect.X)*scale
+		top := offY + float64(dc.Rect.Y)*scale
+		rw, rh := float64(dc.Rect.Width)*scale, float64(dc.Rect.Height)*scale
+		cx, cy := left+rw/2.0, pageH-(top+rh/2.0)
+
+		// the card's own width and height, before it is turned
+		which := dc.Index
+		cw, ch := rw, rh
+		angle := 0.0
+		if dc.Sideways {
+			cw, ch = rh, rw
+			angle += 90.0
+		}
+		if dc.Tilt != 0 {
+			// the rectangle only bounds a tilted card
+			cw = float64(rd.CardWidth) * scale
+			ch = float64(dk.CardHeight(rd.CardWidth)) * scale
+			angle += dc.Tilt
+		}
+		if dc.Upended {
+			angle += 180.0
+		}
+		if dc.FaceDown {
+			which = backCard
+		} else if dc.Reversed {
+			angle += 180.0
+		}
+
+		// turn the page around the center of the card, then fit
+		// the image there, clipping it to the card if cropped
+		sin, cos := math.Sincos(angle * math.Pi / 180.0)
+		fmt.Fprintf(&content, "q %.4f %.4f %.4f %.4f %.3f %.3f cm\n", cos, sin, -sin, cos, cx, cy)
+		radius := math.Min(float64(ro.style.radius)*scale, math.Min(cw, ch)/2.0)
+		content.WriteString("q ")
+		if radius > 0 {
+			fmt.Fprintf(&content, "%s W n\n", pdfRoundedRect(-cw/2.0, -ch/2.0, cw, ch, radius))
+		}
+		if which == backCard && !dk.HasBack() {
+			inset := cw / 12.0
+			fmt.Fprintf(&content, "%s rg %.3f %.3f %.3f %.3f re f\n",
+				pdfColor(backBorder), -cw/2.0, -ch/2.0, cw, ch)
+			fmt.Fprintf(&content, "%s rg %.3f %.3f %.3f %.3f re f Q\n",
+				pdfColor(backColor), inset-cw/2.0, inset-ch/2.0, cw-2*inset, ch-2*inset)
+		} else {
+			dw, dh := cw, ch
+			if native := dk.CardSize(which); native.X > 0 && native.Y > 0 {
+				sx, sy := ro.fit.fitScale(float64(native.X), float64(native.Y), cw, ch)
+				dw, dh = float64(native.X)*sx, float64(native.Y)*sy
+			}
+			if ro.fit == fitCrop {
+				fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re W n\n", -cw/2.0, -ch/2.0, cw, ch)
+			}
+			fmt.Fprintf(&content, "%.3f 0 0 %.3f %.3f %.3f cm /%s Do Q\n",
+				dw, dh, -dw/2.0, -dh/2.0, pdfImageName(which))
+		}
+
+		// the border is stroked along the inside of the card's edge
+		if bw := math.Min(float64(ro.style.border)*scale, math.Min(cw, ch)/2.0); bw > 0 {
+			fmt.Fprintf(&content, "%s RG %.3f w %s S\n", pdfColor(ro.style.borderColor), bw,
+				pdfRoundedRect(bw/2.0-cw/2.0, bw/2.0-ch/2.0, cw-bw, ch-bw, math.Max(0, radius-bw/2.0)))
+		}
+		content.WriteString("Q\n")
+
+		var captions []string
+		if po.positions && dc.Position != "" {
+			captions = append(captions, dc.Position)
+		}
+		if po.names && !dc.FaceDown {
+			captions = append(captions, dc.Name)
+		}
+		baseline := pageH - (top + rh) - fontSize*1.1
+		for _, line := range captions {
+			txt, tw := pdfText(line, fontSize)
+			fmt.Fprintf(&content, "BT /F1 %.1f Tf %.3f %.3f Td (%s) Tj ET\n",
+				fontSize, cx-tw/2.0, baseline, txt)
+			baseline -= fontSize * 1.2
+		}
+	}
+
+	contents := pd.add(pdfStream("/Filter /FlateDecode", deflate(content.Bytes())))
+
+	pd.set(catalog, []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages)))
+	pd.set(pages, []byte(fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", page)))
+	pd.set(page, []byte(fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R >> /XObject <<%s >> >> >>",
+		pages, pageW, pageH, contents, font, xobjs.String())))
+
+	_, err := pd.WriteTo(w)
+	return err
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNewPDFOpts(t *testing.T) {
+	tests := []struct {
+		paper, orient, captions string
+		dpi                     float64
+		want                    string // the options, or empty when it fails
+	}{
+		{"", "", "", 0, "letter auto"},
+		{"A4", "landscape", "both", 150, "a4 landscape positions names dpi=150"},
+		{"legal", "portrait", "name", 0, "legal names"},
+		{"a5", "Auto", "position", 0, "a5 auto positions"},
+		{"tabloid", "", "none", 0, "tabloid auto"},
+		{"b5", "", "", 0, ""},
+		{"", "sideways", "", 0, ""},
+		{"", "", "numbers", 0, ""},
+		{"", "", "", -72, ""},
+	}
+	for _, tt := range tests {
+		po, err := newPDFOpts(tt.paper, tt.orient, tt.captions, tt.dpi)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("newPDFOpts(%q, %q, %q, %g) = %+v, want an error", tt.paper, tt.orient, tt.captions, tt.dpi, po)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newPDFOpts(%q, %q, %q, %g): %v", tt.paper, tt.orient, tt.captions, tt.dpi, err)
+			continue
+		}
+		got := []string{po.paper}
+		for _, opt := range []struct {
+			on   bool
+			name string
+		}{{po.auto, "auto"}, {po.landscape, "landscape"}, {po.positions, "positions"}, {po.names, "names"}} {
+			if opt.on {
+				got = append(got, opt.name)
+			}
+		}
+		if po.dpi != 0 {
+			got = append(got, fmt.Sprintf("dpi=%g", po.dpi))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("newPDFOpts(%q, %q, %q, %g) gave %q, want %q",
+				tt.paper, tt.orient, tt.captions, tt.dpi, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+// encoded gives the image, encoded by the function.
+func encoded(img image.Image, encode func(*bytes.Buffer, image.Image) error) []byte {
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAddImage(t *testing.T) {
+	rgb := image.NewRGBA(image.Rect(0, 0, 6, 4))
+	draw := func(img interface{ Set(x, y int, c color.Color) }, c color.Color) {
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 6; x++ {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	draw(rgb, color.RGBA{0x20, 0x40, 0x60, 0xff})
+	gray := image.NewGray(rgb.Bounds())
+	draw(gray, color.Gray{0x80})
+	seeThrough := image.NewNRGBA(rgb.Bounds())
+	draw(seeThrough, color.NRGBA{0x20, 0x40, 0x60, 0x80})
+
+	toJPEG := func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+	toPNG := func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+	tests := []struct {
+		what string
+		data []byte
+		dict string // how the image is described; empty when it fails
+		objs int    // two when it needs a soft mask
+	}{
+		{"a color JPEG", encoded(rgb, toJPEG), "/DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", 1},
+		{"a gray JPEG", encoded(gray, toJPEG), "/DeviceGray /BitsPerComponent 8 /Filter /DCTDecode", 1},
+		{"an opaque PNG", encoded(rgb, toPNG), "/DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode", 1},
+		{"a PNG with transparency", encoded(seeThrough, toPNG), "/FlateDecode /SMask 1 0 R", 2},
+		{"something else", []byte("not an image"), "", 0},
+	}
+	for _, tt := range tests {
+		pd := &pdfDoc{}
+		num, err := pd.addImage(tt.data)
+		if tt.dict == "" {
+			if err == nil {
+				t.Errorf("adding %s succeeded, want an error", tt.what)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("adding %s: %v", tt.what, err)
+			continue
+		}
+		if num != tt.objs || len(pd.objs) != tt.objs {
+			t.Errorf("adding %s made object %d of %d, want %d", tt.what, num, len(pd.objs), tt.objs)
+			continue
+		}
+		dict := string(pd.objs[num-1])
+		if !strings.Contains(dict, "/Width 6 /Height 4 ") || !strings.Contains(dict, tt.dict) ||
+			strings.Contains(dict, "/SMask") != (tt.objs == 2) {
+			t.Errorf("adding %s gave %.120q, want it to have %q", tt.what, pd.objs[num-1], tt.dict)
+		}
+	}
+}
+
+// imageDeck makes a test deck whose cards are little PNGs.
+func imageDeck(n int) *deck {
+	dk := testDeck(n)
+	for idx := range dk.imgs {
+		img := image.NewGray(image.Rect(0, 0, 7, 10))
+		img.Pix[0] = uint8(idx)
+		dk.imgs[idx] = memFile{name: dk.imgs[idx].Name(), data: encoded(img, func(buf *bytes.Buffer, img image.Image) error {
+			return png.Encode(buf, img)
+		})}
+		dk.sizes = append(dk.sizes, image.Pt(7, 10))
+	}
+	return dk
+}
+
+func TestWritePDF(t *testing.T) {
+	tests := []struct {
+		cols, count int
+		paper       string
+		orient      string
+		mediaBox    string
+	}{
+		{3, 3, "letter", "", "0 0 792 612"},
+		{1, 3, "letter", "", "0 0 612 792"},
+		{3, 3, "a4", "portrait", "0 0 595 842"},
+		{1, 3, "a4", "landscape", "0 0 842 595"},
+	}
+	obj := regexp.MustCompile(`^(\d+) 0 obj\n`)
+	for _, tt := range tests {
+		dk := imageDeck(5)
+		rd, err := gridOf("Test", tt.cols, tt.count, 0).deal(rand.New(rand.NewSource(1)), dk, 300, 50, spacing{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd.Cards[1].FaceDown = true
+		ro, _ := newRenderOpts(nil)
+		po, err := newPDFOpts(tt.paper, tt.orient, "both", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := rd.writePDF(&buf, dk, ro, po); err != nil {
+			t.Errorf("writing %d cards on %s: %v", tt.count, tt.paper, err)
+			continue
+		}
+		pdf := buf.String()
+		if !strings.HasPrefix(pdf, "%PDF-1.4\n") || !strings.HasSuffix(pdf, "%%EOF\n") {
+			t.Errorf("writing %d cards on %s gave no PDF: %.40q", tt.count, tt.paper, pdf)
+			continue
+		}
+		if want := "/MediaBox [" + tt.mediaBox + "]"; !strings.Contains(pdf, want) {
+			t.Errorf("writing %d in %d columns on %s %s has no %s", tt.count, tt.cols, tt.paper, tt.orient, want)
+		}
+
+		// the face-down card has no back to show, so only the
+		// other two are embedded
+		if n := strings.Count(pdf, "/Subtype /Image"); n != 2 {
+			t.Errorf("writing %d cards, one face-down, embedded %d images", tt.count, n)
+		}
+
+		// every object is where the cross-reference table says
+		at := strings.LastIndex(pdf, "startxref\n")
+		xref, _ := strconv.Atoi(strings.Fields(pdf[at+len("startxref\n"):])[0])
+		lines := strings.Split(pdf[xref:], "\n")
+		size, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+		for num := 1; num < size; num++ {
+			off, _ := strconv.Atoi(strings.Fields(lines[2+num])[0])
+			if m := obj.FindStringSubmatch(pdf[off:]); m == nil || m[1] != strconv.Itoa(num) {
+				t.Errorf("object %d isn't at %d, where the table puts it", num, off)
+			}
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+// a reading is a spread with the cards dealt out: which card
+// landed in each position, which way it faces, and where it
+// goes in the final image.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rect is a pixel rectangle within the reading's image.
+type rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (r rect) image() image.Rectangle { return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height) }
+
+// a drawnCard is one card dealt into a position of the spread.
+type drawnCard struct {
+	Position string  `json:"position"`
+	Index    int     `json:"index"`
+	File     string  `json:"file"`
+	Name     string  `json:"name"`
+	Number   *int    `json:"number,omitempty"`
+	Suit     string  `json:"suit,omitempty"`
+	Arcana   string  `json:"arcana,omitempty"`
+	Meaning  string  `json:"meaning,omitempty"`
+	Reversed bool    `json:"reversed"`
+	Sideways bool    `json:"sideways"`
+	Upended  bool    `json:"upended,omitempty"` // the position turns it a half turn
+	Tilt     float64 `json:"tilt,omitempty"`
+	FaceDown bool    `json:"faceDown,omitempty"`
+	Chosen   bool    `json:"chosen,omitempty"` // the significator
+	Rect     rect    `json:"rect"`
+}
+
+type reading struct {
+	ID        string      `json:"id,omitempty"`
+	Time      time.Time   `json:"time"`
+	Deck      string      `json:"deck"`
+	Title     string      `json:"title"`
+	Layout    string      `json:"layout"`
+	Client    string      `json:"client,omitempty"`
+	Params    url.Values  `json:"params,omitempty"`
+	Seed      int64       `json:"seed"`
+	Width     int         `json:"width"`
+	Height    int         `json:"height"`
+	CardWidth int         `json:"cardWidth"`
+	Cards     []drawnCard `json:"cards"`
+}
+
+// deckName gives the short name of a deck, as the user
+// would request it.
+func deckName(dk *deck) string { return shortDeckName(dk.Name()) }
+
+// spacing gives the room, in pixels, around the whole spread
+// (the margin) and between neighboring cards (the gutter).
+type spacing struct {
+	margin, gutter int
+}
+
+// deal shuffles the deck and lays out the spread at the requested
+// overall width.  The reversals are given as a percentage.  All
+// of the randomness comes from rng, so the same seed gives the
+// same reading.  A significator, if any, is kept out of the shuffle
+// and placed upright in its position.
+func (s *spread) deal(rng *rand.Rand, dk *deck, desiredWidth int, desiredReversals int, sp spacing, sig *significator) (*reading, error) {
+	revN := 1.0 - float64(desiredReversals)/100.0
+
+	// each card width along the spread takes a gutter with it,
+	// less the one gutter that isn't needed at the end
+	cardWidth := int(float64(desiredWidth-2*sp.margin+sp.gutter)/s.Width) - sp.gutter
+	if cardWidth < 1 {
+		return nil, fmt.Errorf("no room for the cards in a width of %d", desiredWidth)
+	}
+	cardSize := image.Point{cardWidth, dk.CardHeight(cardWidth)}
+	gutterX, gutterY := float64(sp.gutter), float64(sp.gutter)
+	if s.proportional {
+		gutterY = gutterX * float64(cardSize.Y) / float64(cardSize.X)
+	}
+	stepX, stepY := float64(cardSize.X)+gutterX, float64(cardSize.Y)+gutterY
+	originX, originY := float64(sp.margin)-gutterX/2.0, float64(sp.margin)-gutterY/2.0
+
+	// now, shuffle the deck, and slip in the significator
+	var selected []int
+	var err error
+	if sig == nil {
+		selected, err = dk.Shuffled(rng, len(s.Positions))
+	} else if selected, err = dk.Shuffled(rng, len(s.Positions)-1, sig.card); err == nil {
+		selected = append(selected, 0)
+		copy(selected[sig.position+1:], selected[sig.position:])
+		selected[sig.position] = sig.card
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &reading{
+		Deck:      deckName(dk),
+		Title:     dk.Title(),
+		Width:     int(s.Width*stepX-gutterX) + 2*sp.margin,
+		Height:    int(s.Height*stepY-gutterY) + 2*sp.margin,
+		CardWidth: cardWidth,
+		Cards:     make([]drawnCard, len(s.Positions)),
+	}
+
+	for idx, p := range s.Positions {
+		dc := &answer.Cards[idx]
+		dc.Position = p.Name
+		dc.Index = selected[idx]
+		dc.File = dk.CardFile(dc.Index)
+		dc.Chosen = sig != nil && idx == sig.position
+
+		// the significator isn't reversed by chance, but the chance
+		// is still drawn, so that the other cards don't change
+		if rng.Float64() >= revN && !dc.Chosen {
+			dc.Reversed = true
+		}
+
+		// the rotation is taken as the nearest quarter turn, and a
+		// tilt of up to 45 degrees either way from there.  Turning the
+		// card is only how it's laid out, so it doesn't change whether
+		// the card reads as reversed.  The significator stays upright.
+		nearest := math.Round(p.Rotation / 90.0)
+		dc.Tilt = p.Rotation - nearest*90.0
+		quarters := (int(nearest)%4 + 4) % 4
+		dc.Upended = quarters >= 2 && !dc.Chosen
+		dc.Sideways = quarters%2 == 1
+		info := dk.Card(dc.Index)
+		dc.Name, dc.Number, dc.Suit, dc.Arcana = info.Name, info.Number, info.Suit, info.Arcana
+		dc.Meaning = dk.Meaning(dc.Index, dc.Reversed)
+		dc.FaceDown = s.FaceDown && !dc.Chosen
+		if p.FaceDown != nil && !dc.Chosen {
+			dc.FaceDown = *p.FaceDown
+		}
+
+		sz := cardSize
+		if dc.Sideways {
+			sz = image.Pt(sz.Y, sz.X)
+		}
+		if dc.Tilt != 0 {
+			sz = tiltedSize(sz, dc.Tilt)
+		}
+		dc.Rect = rect{
+			X:      int(math.Round(originX + p.X*stepX - float64(sz.X)/2.0)),
+			Y:      int(math.Round(originY + p.Y*stepY - float64(sz.Y)/2.0)),
+			Width:  sz.X,
+			Height: sz.Y,
+		}
+	}
+
+	return answer, nil
+}
+
+// turnCards applies the facedown and reveal parameters to a
+// reading.  Facedown turns every card over but the significator, and
+// reveal gives the positions (counting from 1, or "all") to turn back
+// face-up.  Since turning cards doesn't touch the shuffle, the same
+// seed with more positions revealed shows the same cards.
+func (rd *reading) turnCards(params url.Values) error {
+	switch strings.ToLower(params.Get("facedown")) {
+	case "", "0", "false", "no":
+	case "1", "true", "yes", "all":
+		for idx := range rd.Cards {
+			rd.Cards[idx].FaceDown = !rd.Cards[idx].Chosen
+		}
+	default:
+		return fmt.Errorf("bad facedown %q", params.Get("facedown"))
+	}
+
+	for _, lst := range params["reveal"] {
+		for _, pos := range strings.Split(lst, ",") {
+			pos = strings.TrimSpace(pos)
+			if pos == "" {
+				continue
+			}
+			if strings.EqualFold(pos, "all") {
+				for idx := range rd.Cards {
+					rd.Cards[idx].FaceDown = false
+				}
+				continue
+			}
+			num, err := strconv.Atoi(pos)
+			if err != nil || num < 1 || num > len(rd.Cards) {
+				return fmt.Errorf("bad position %q to reveal", pos)
+			}
+			rd.Cards[num-1].FaceDown = false
+		}
+	}
+	return nil
+}
+
+// copy gives a copy of the reading that can be changed
+// without touching the original.
+func (rd *reading) copy() *reading {
+	answer := *rd
+	answer.Cards = append([]drawnCard(nil), rd.Cards...)
+	return &answer
+}
+
+// scaled gives a copy of the reading laid out at another
+// width, such as for a thumbnail.
+func (rd *reading) scaled(width int) *reading {
+	answer := rd.copy()
+	if rd.Width <= 0 {
+		return answer
+	}
+	f := float64(width) / float64(rd.Width)
+	sc := func(n int) int { return int(math.Round(float64(n) * f)) }
+
+	answer.Width, answer.Height, answer.CardWidth = width, sc(rd.Height), sc(rd.CardWidth)
+	for idx := range answer.Cards {
+		r := &answer.Cards[idx].Rect
+		r.X, r.Y, r.Width, r.Height = sc(r.X), sc(r.Y), sc(r.Width), sc(r.Height)
+	}
+	return answer
+}
+
+// concealed gives a copy of the reading that doesn't give away
+// the cards that are face-down.
+func (rd *reading) concealed() *reading {
+	answer := *rd
+	answer.Cards = make([]drawnCard, len(rd.Cards))
+	for idx, dc := range rd.Cards {
+		if dc.FaceDown {
+			dc.Index = backCard
+			dc.File, dc.Name, dc.Meaning = "", "", ""
+			dc.Number, dc.Suit, dc.Arcana = nil, "", ""
+			dc.Reversed = false
+		}
+		answer.Cards[idx] = dc
+	}
+	return &answer
+}
+
+// plainBack stands in for the card back, when the deck doesn't
+// have one.
+func plainBack(size image.Point) image.Image {
+	answer := image.NewRGBA(image.Rectangle{image.ZP, size})
+	draw.Draw(answer, answer.Bounds(), &image.Uniform{backBorder}, image.ZP, draw.Src)
+	inset := size.X / 12
+	draw.Draw(answer, answer.Bounds().Inset(inset), &image.Uniform{backColor}, image.ZP, draw.Src)
+	return answer
+}
+
+var (
+	backColor  = color.RGBA{0x28, 0x34, 0x5c, 0xff}
+	backBorder = color.RGBA{0xe8, 0xe4, 0xd8, 0xff}
+)
+
+// renderOpts are the choices about how to draw a reading, as
+// opposed to which cards are in it.
+type renderOpts struct {
+	fit        fitMode
+	labels     labelSet
+	labelsOver bool // draw labels over the cards, rather than below
+	background color.Color
+	texture    image.Image // tiled over the background, if given
+	style      cardStyle
+}
+
+func newRenderOpts(params url.Values) (*renderOpts, error) {
+	fit, err := parseFit(params.Get("fit"))
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseLabels(params.Get("labels"))
+	if err != nil {
+		return nil, err
+	}
+	over, err := parseLabelsOver(params.Get("labelpos"))
+	if err != nil {
+		return nil, err
+	}
+	bg, err := parseColor(params.Get("bg"))
+	if err != nil {
+		return nil, err
+	}
+	style, err := newCardStyle(params)
+	if err != nil {
+		return nil, err
+	}
+	ro := &renderOpts{fit: fit, labels: labels, labelsOver: over, background: bg, style: style}
+	if name := params.Get("texture"); name != "" {
+		if ro.texture, err = loadTexture(name); err != nil {
+			return nil, err
+		}
+	}
+	return ro, nil
+}
+
+// render draws the cards of the reading from the deck.  When
+// labels go below the cards, the image grows to make room for
+// them.
+func (rd *reading) render(dk *deck, ro *renderOpts) image.Image {
+	scale := labelScale(rd.CardWidth)
+	labels := make([][]string, len(rd.Cards))
+	bounds := image.Rect(0, 0, rd.Width, rd.Height)
+	for idx, dc := range rd.Cards {
+		labels[idx] = ro.labels.lines(idx, dc)
+		bounds = bounds.Union(rd.labelRect(dc, len(labels[idx]), scale, ro.labelsOver))
+	}
+	answer := image.NewRGBA(image.Rect(0, 0, rd.Width, bounds.Max.Y))
+	if ro.texture != nil {
+		draw.Draw(answer, answer.Bounds(), &tiledImage{ro.texture}, image.ZP, draw.Src)
+	} else {
+		draw.Draw(answer, answer.Bounds(), &image.Uniform{ro.background}, image.ZP, draw.Src)
+	}
+
+	for _, dc := range rd.Cards {
+		// a reversed card in an upended position comes out upright
+		co := cardOpts{reversed: dc.Reversed != dc.Upended, onSide: dc.Sideways, fit: ro.fit}
+		which := dc.Index
+		if dc.FaceDown {
+			// backs turn with the position, but aren't reversed, lest
+			// they give the card away
+			which, co.reversed = backCard, dc.Upended
+		}
+
+		var cardImg image.Image
+		var err error
+		if which == backCard && !dk.HasBack() {
+			cardImg = plainBack(image.Pt(rd.CardWidth, dk.CardHeight(rd.CardWidth)))
+			if co.onSide {
+				cardImg = &sidewaysCard{cardImg}
+			}
+		} else if cardImg, err = dk.Image(which, rd.CardWidth, co); err != nil {
+			log.Print(err)
+			cardImg = image.Black
+		}
+
+		if dc.Tilt != 0 {
+			ro.style.drawTilted(answer, dc.Rect.image(), cardImg, dc.Tilt)
+		} else {
+			ro.style.drawCard(answer, dc.Rect.image(), cardImg)
+		}
+	}
+
+	// labels go on last, so that no card covers them
+	for idx, dc := range rd.Cards {
+		if len(labels[idx]) > 0 {
+			drawLabel(answer, rd.labelRect(dc, len(labels[idx]), scale, ro.labelsOver), labels[idx], scale)
+		}
+	}
+
+	return answer
+}
+
+// layoutDeck gives the deck the named layout asks for, if any.
+func layoutDeck(name string) (string, error) {
+	lay, ok := layouts[name]
+	if !ok {
+		return "", errUnknownLayout
+	}
+	switch lay := lay.(type) {
+	case *spread:
+		return lay.Deck, nil
+	case deckedLayout:
+		return lay.deck, nil
+	}
+	return "", nil
+}
+
+// layoutSpread finds the named layout, and produces its spread
+// for the given parameters and deck.
+func layoutSpread(name string, params url.Values, ds deckShape) (*spread, error) {
+	lay, ok := layouts[name]
+	if !ok {
+		return nil, errUnknownLayout
+	}
+	return lay.Spread(params, ds)
+}
+
+// dealSpread deals a reading of the spread from the deck, with
+// the width, reversals and seed given in the parameters.
+func dealSpread(spr *spread, name string, params url.Values, dk *deck) (*reading, error) {
+	desiredWidth, _ := strconv.Atoi(getOrElse(params["width"], "600"))
+	desiredReversals, _ := strconv.Atoi(getOrElse(params["rev"], "50"))
+	margin, err := pixelParam(params, "margin")
+	if err != nil {
+		return nil, err
+	}
+	gutter, err := pixelParam(params, "gutter")
+	if err != nil {
+		return nil, err
+	}
+	seed, err := requestSeed(params["seed"])
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%s: %s Cards: %d  Width: %d  Reversals: %d%% Seed: %d",
+		strings.ToUpper(name),
+		deckName(dk),
+		len(spr.Positions),
+		desiredWidth,
+		desiredReversals,
+		seed)
+
+	sig, err := parseSignificator(params, spr, dk)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	rd, err := spr.deal(rng, dk, desiredWidth, desiredReversals, spacing{margin, gutter}, sig)
+	if err != nil {
+		return nil, err
+	}
+	rd.Layout = name
+	rd.Seed = seed
+	rd.Time = time.Now()
+	rd.Client = params.Get("client")
+
+	// keep the parameters that were given, for the history
+	rd.Params = make(url.Values)
+	for key, vals := range params {
+		if key != "client" && getOrElse(vals, "") != "" {
+			rd.Params[key] = vals
+		}
+	}
+	if err = rd.turnCards(params); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// pixelParam parses a parameter giving a number of pixels,
+// which is zero when not given or left empty.
+func pixelParam(params url.Values, name string) (int, error) {
+	s := params.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad %s %q", name, params.Get(name))
+	}
+	return n, nil
+}
+
+// requestSeed parses the seed parameter, or picks a fresh
+// random seed when none is given.  Fresh seeds are kept under
+// 2^53 so that they survive a trip through JavaScript.
+func requestSeed(lst []string) (int64, error) {
+	if len(lst) == 0 || lst[0] == "" {
+		return rand.Int63n(1 << 53), nil
+	}
+	seed, err := strconv.ParseInt(lst[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad seed %q", lst[0])
+	}
+	return seed, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"testing"
+)
+
+func TestTurnCards(t *testing.T) {
+	tests := []struct {
+		query string
+		down  string // which of four cards end up face-down
+		fails bool
+	}{
+		{"", "....", false},
+		{"facedown=0", "....", false},
+		{"facedown=1", "DDDD", false},
+		{"facedown=1&reveal=2", "D.DD", false},
+		{"facedown=1&reveal=1,4&reveal=3", ".D..", false},
+		{"facedown=yes&reveal=all", "....", false},
+		{"facedown=1&reveal=", "DDDD", false},
+		{"facedown=maybe", "", true},
+		{"facedown=1&reveal=5", "", true},
+		{"facedown=1&reveal=0", "", true},
+		{"facedown=1&reveal=first", "", true},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		rd := &reading{Cards: make([]drawnCard, 4)}
+		err := rd.turnCards(params)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("turnCards(%q) succeeded, want an error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("turnCards(%q): %v", tt.query, err)
+			continue
+		}
+		if got := faceDowns(rd); got != tt.down {
+			t.Errorf("turnCards(%q) left %s, want %s", tt.query, got, tt.down)
+		}
+	}
+
+	// the significator stays face-up
+	rd := &reading{Cards: make([]drawnCard, 3)}
+	rd.Cards[1].Chosen = true
+	rd.turnCards(url.Values{"facedown": {"1"}})
+	if got := faceDowns(rd); got != "D.D" {
+		t.Errorf("facedown=1 with a significator left %s, want D.D", got)
+	}
+}
+
+// faceDowns marks the face-down cards of a reading with a D.
+func faceDowns(rd *reading) string {
+	var answer []byte
+	for _, dc := range rd.Cards {
+		if dc.FaceDown {
+			answer = append(answer, 'D')
+		} else {
+			answer = append(answer, '.')
+		}
+	}
+	return string(answer)
+}
+
+func TestDealSignificator(t *testing.T) {
+	spr := gridOf("Test", 5, 5, 0)
+	spr.Positions[3].Rotation = 180
+	dk := testDeck(10)
+
+	plain, err := spr.deal(rand.New(rand.NewSource(7)), dk, 500, 0, spacing{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pos := range spr.Positions {
+		sig := &significator{card: 6, position: pos}
+		rd, err := spr.deal(rand.New(rand.NewSource(7)), dk, 500, 100, spacing{}, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var others []int
+		for idx, dc := range rd.Cards {
+			if idx == pos {
+				if dc.Index != 6 || !dc.Chosen || dc.Reversed || dc.Upended || dc.FaceDown {
+					t.Errorf("significator in position %d came out as %+v", pos, dc)
+				}
+				continue
+			}
+			if dc.Index == 6 || dc.Chosen {
+				t.Errorf("significator for position %d turned up in position %d", pos, idx)
+			}
+			if !dc.Reversed {
+				t.Errorf("card in position %d isn't reversed, with rev=100", idx)
+			}
+			if dc.Upended != (spr.Positions[idx].Rotation == 180) {
+				t.Errorf("card in position %d, turned %g, has upended %v",
+					idx, spr.Positions[idx].Rotation, dc.Upended)
+			}
+			others = append(others, dc.Index)
+		}
+
+		// the other cards come in the order they would without it
+		var want []int
+		for _, dc := range plain.Cards {
+			if dc.Index != 6 && len(want) < len(others) {
+				want = append(want, dc.Index)
+			}
+		}
+		if fmt.Sprint(others) != fmt.Sprint(want) {
+			t.Errorf("with the significator in position %d, the others are %v, want %v", pos, others, want)
+		}
+	}
+}
+
+func TestDealRotation(t *testing.T) {
+	tests := []struct {
+		rotation          float64
+		sideways, upended bool
+		tilt              float64
+	}{
+		{0, false, false, 0},
+		{90, true, false, 0},
+		{180, false, true, 0},
+		{270, true, true, 0},
+		{-90, true, true, 0},
+		{170, false, true, -10},
+		{200, false, true, 20},
+		{30, false, false, 30},
+		{-30, false, false, -30},
+		{1, false, false, 1},
+		{440, true, false, -10},
+	}
+	for _, rev := range []int{0, 100} {
+		for _, tt := range tests {
+			spr := gridOf("Test", 1, 1, 0)
+			spr.Positions[0].Rotation = tt.rotation
+			rd, err := spr.deal(rand.New(rand.NewSource(1)), testDeck(3), 500, rev, spacing{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dc := rd.Cards[0]
+			if dc.Sideways != tt.sideways || dc.Upended != tt.upended || math.Abs(dc.Tilt-tt.tilt) > 1e-9 {
+				t.Errorf("rotation %g gave sideways %v, upended %v and tilt %g, want %v, %v and %g",
+					tt.rotation, dc.Sideways, dc.Upended, dc.Tilt, tt.sideways, tt.upended, tt.tilt)
+			}
+			// the rotation is only the layout: rev alone reverses cards
+			if dc.Reversed != (rev == 100) {
+				t.Errorf("rotation %g with rev=%d gave reversed %v", tt.rotation, rev, dc.Reversed)
+			}
+		}
+	}
+}
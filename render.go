@@ -0,0 +1,116 @@
+package main
+
+// the render subcommand draws a reading straight to a file,
+// without starting the server, for use in scripts:
+//
+//    carddiv render -layout celtic -deck Tarot.zip -o out.png seed=42
+//
+// Any layout parameters not covered by the flags (such as cards
+// and pct for a row) follow as name=value pairs.
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func renderCommand(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	layoutName := fs.String("layout", "row", "the layout to draw")
+	deckPath := fs.String("deck", safeDeck, "the deck, as a path or a resource name")
+	fs.Int("width", 600, "width of the image, in pixels")
+	fs.Int("rev", 50, "percentage of cards reversed")
+	fs.String("seed", "", "seed for the shuffle (random if not given)")
+	outFile := fs.String("o", "reading.jpg", "output file: .jpg, .png or .pdf")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: carddiv render [flags] [name=value ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	params := url.Values{}
+	for _, kv := range fs.Args() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("render: expected name=value, got %q", kv)
+		}
+		params.Add(parts[0], parts[1])
+	}
+
+	// the flags only stand in for their parameters when given, so
+	// that seed=42 works as well as -seed 42.  The server's defaults
+	// are the same as the flags'.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "width", "rev", "seed":
+			params.Set(f.Name, f.Value.String())
+		}
+	})
+
+	// take the deck as a path if it exists, and otherwise
+	// look for it among the resources
+	fullname := *deckPath
+	if _, err := os.Stat(fullname); err != nil {
+		if fullname, err = findDeck(*deckPath); err != nil {
+			return err
+		}
+	}
+	dk, err := newDeck(fullname)
+	if err != nil {
+		return err
+	}
+	dk.Open()
+	defer dk.Close()
+
+	spr, err := layoutSpread(*layoutName, params, dk.shape())
+	if err != nil {
+		return fmt.Errorf("render: %s: %v", *layoutName, err)
+	}
+
+	rd, err := dealSpread(spr, *layoutName, params, dk)
+	if err != nil {
+		return err
+	}
+	ro, err := newRenderOpts(params)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(*outFile)
+	if err != nil {
+		return err
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(*outFile)), ".")
+	if format == "pdf" {
+		dpi, _ := strconv.ParseFloat(params.Get("dpi"), 64)
+		var po *pdfOpts
+		po, err = newPDFOpts(params.Get("paper"), params.Get("orient"), params.Get("captions"), dpi)
+		if err == nil {
+			err = rd.writePDF(out, dk, ro, po)
+		}
+	} else {
+		var quality int
+		var enc *encoder
+		if quality, err = parseQuality(params.Get("quality")); err == nil {
+			enc, err = newEncoder(format, quality)
+		}
+		if err == nil {
+			err = enc.encode(out, rd.render(dk, ro))
+		}
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*outFile)
+		return err
+	}
+	fmt.Printf("%s: seed %d\n", *outFile, rd.Seed)
+	return nil
+}
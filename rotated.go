@@ -3,11 +3,14 @@ package main
 import (
 	"image"
 	"image/color"
+	"image/draw"
+	"math"
 )
 
 // Here are some rotated image structs (just for 180 and 90 degrees).
 // They are implemented by wrapping an image.Image, and translating
-// coordinates on the fly.
+// coordinates on the fly.  Any other angle is a tilt, which has to
+// be resampled into a new image.
 
 // A revesedCard is flipped 180 degrees.
 type reversedCard struct {
@@ -36,3 +39,63 @@ func (sc *sidewaysCard) At(x, y int) color.Color {
 	var b = sc.Image.Bounds()
 	return sc.Image.At(b.Max.X-y+b.Min.X, x)
 }
+
+// tiltedSize gives the size of the box that holds a rectangle
+// of the given size, tilted by the angle.
+func tiltedSize(sz image.Point, degrees float64) image.Point {
+	sin, cos := math.Sincos(degrees * math.Pi / 180.0)
+	sin, cos = math.Abs(sin), math.Abs(cos)
+	w := float64(sz.X)*cos + float64(sz.Y)*sin
+	h := float64(sz.X)*sin + float64(sz.Y)*cos
+	return image.Pt(int(math.Round(w)), int(math.Round(h)))
+}
+
+// tiltImage turns the image by the angle (in degrees, counter-
+// clockwise), sampling it bilinearly.  The answer is the size
+// given by tiltedSize, and transparent outside the turned image.
+func tiltImage(img image.Image, degrees float64) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rectangle{image.ZP, b.Size()})
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	size := tiltedSize(b.Size(), degrees)
+	answer := image.NewRGBA(image.Rectangle{image.ZP, size})
+	sin, cos := math.Sincos(degrees * math.Pi / 180.0)
+	scx, scy := float64(b.Dx())/2.0, float64(b.Dy())/2.0
+	dcx, dcy := float64(size.X)/2.0, float64(size.Y)/2.0
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			// turn the center of the pixel back into the source
+			// (y runs down, so counter-clockwise is a negative angle)
+			dx, dy := float64(x)+0.5-dcx, float64(y)+0.5-dcy
+			sx := dx*cos - dy*sin + scx - 0.5
+			sy := dx*sin + dy*cos + scy - 0.5
+			answer.SetRGBA(x, y, bilinear(src, sx, sy))
+		}
+	}
+	return answer
+}
+
+// bilinear samples the image between pixels, weighing the four
+// nearest.  Pixels outside the image count as transparent, which
+// smooths the edges of a tilted card.
+func bilinear(img *image.RGBA, x, y float64) color.RGBA {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	var sum [4]float64
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 2; i++ {
+			p := image.Pt(x0+i, y0+j)
+			if !p.In(img.Rect) {
+				continue
+			}
+			wt := math.Abs(1-float64(i)-fx) * math.Abs(1-float64(j)-fy)
+			off := img.PixOffset(p.X, p.Y)
+			for c := range sum {
+				sum[c] += wt * float64(img.Pix[off+c])
+			}
+		}
+	}
+	return color.RGBA{uint8(sum[0] + 0.5), uint8(sum[1] + 0.5), uint8(sum[2] + 0.5), uint8(sum[3] + 0.5)}
+}
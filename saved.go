@@ -0,0 +1,201 @@
+package main
+
+// every reading the server deals is saved under an ID, so that
+// it can be sent to someone as a link and seen again later.  The
+// latest readings are kept in memory and, when asked, appended to
+// a file of JSON lines as they are dealt, so that they survive a
+// restart.  Once the file holds twice as many readings as are
+// kept, it is rewritten with just the ones kept.
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+type readingStore struct {
+	lock  sync.Mutex
+	fn    string   // the file, or "" when readings are only kept in memory
+	file  *os.File // open to append to fn
+	lines int      // readings in the file, kept or not
+	limit int      // the most readings to keep, or 0 for all of them
+	byID  map[string]*reading
+	order []*reading // oldest first
+}
+
+var savedReadings = &readingStore{byID: make(map[string]*reading)}
+
+// open loads the readings saved in fn, and keeps the file open
+// to add new ones.  Lines that can't be read are skipped, so one
+// bad line doesn't lose the rest.
+func (rs *readingStore) open(fn string) error {
+	f, err := os.OpenFile(fn, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		rs.lines++
+		var rd reading
+		if err := json.Unmarshal(scanner.Bytes(), &rd); err != nil || rd.ID == "" {
+			log.Printf("%s:%d: skipping unreadable reading", fn, line)
+			continue
+		}
+		rs.add(&rd)
+	}
+	if err = scanner.Err(); err != nil {
+		f.Close()
+		return err
+	}
+	rs.fn, rs.file = fn, f
+	if rs.limit > 0 && rs.lines > rs.limit {
+		return rs.compact()
+	}
+	return nil
+}
+
+// add puts a reading into the in-memory index, forgetting the
+// oldest reading if that makes too many.  The lock must be held.
+func (rs *readingStore) add(rd *reading) {
+	rs.byID[rd.ID] = rd
+	rs.order = append(rs.order, rd)
+	for rs.limit > 0 && len(rs.order) > rs.limit {
+		delete(rs.byID, rs.order[0].ID)
+		rs.order[0] = nil
+		rs.order = rs.order[1:]
+	}
+}
+
+// compact rewrites the file with only the readings kept in
+// memory, replacing it once the new one is complete.  The lock
+// must be held.
+func (rs *readingStore) compact() error {
+	tmp := rs.fn + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, rd := range rs.order {
+		js, err := json.Marshal(rd)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		w.Write(append(js, '\n'))
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, rs.fn)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if f, err = os.OpenFile(rs.fn, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	rs.file.Close()
+	rs.file, rs.lines = f, len(rs.order)
+	return nil
+}
+
+// save gives the reading a fresh ID, and stores it.
+func (rs *readingStore) save(rd *reading) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	var err error
+	rd.ID = ""
+	for rd.ID == "" || rs.byID[rd.ID] != nil {
+		if rd.ID, err = newReadingID(); err != nil {
+			rd.ID = ""
+			return err
+		}
+	}
+
+	saved := rd.copy()
+	if rs.file != nil {
+		js, err := json.Marshal(saved)
+		if err != nil {
+			rd.ID = ""
+			return err
+		}
+		if _, err = rs.file.Write(append(js, '\n')); err != nil {
+			rd.ID = ""
+			return err
+		}
+		rs.lines++
+	}
+	rs.add(saved)
+
+	// the reading is saved either way, so a failure to compact
+	// is only logged, to be tried again with the next reading
+	if rs.file != nil && rs.limit > 0 && rs.lines >= 2*rs.limit {
+		if err := rs.compact(); err != nil {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// lookup finds a saved reading.  It gives back a copy, which
+// the caller is free to change.
+func (rs *readingStore) lookup(id string) (*reading, bool) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rd, ok := rs.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return rd.copy(), true
+}
+
+// newReadingID makes up a short random ID that is safe to
+// put in a URL.
+func newReadingID() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("making a reading ID: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// savedDeck opens the deck a saved reading was dealt from.
+// Unlike requestDeck, it won't substitute another deck, since
+// the reading would make no sense in it.  The caller must Close
+// the deck.
+func savedDeck(rd *reading) (*deck, error) {
+	dk, err := requestDeck(rd.Deck)
+	if err != nil {
+		return nil, err
+	}
+	if deckName(dk) != rd.Deck {
+		dk.Close()
+		return nil, fmt.Errorf("the deck %q is no longer available", rd.Deck)
+	}
+	for _, dc := range rd.Cards {
+		if dc.Index >= dk.NumCards() {
+			dk.Close()
+			return nil, fmt.Errorf("the deck %q has changed since the reading", rd.Deck)
+		}
+	}
+	return dk, nil
+}
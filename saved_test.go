@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ids lists the IDs of the readings the store keeps, oldest first.
+func ids(rs *readingStore) string {
+	var answer []string
+	for _, rd := range rs.order {
+		answer = append(answer, rd.ID)
+		if rs.byID[rd.ID] != rd {
+			answer = append(answer, "(unindexed)")
+		}
+	}
+	if len(rs.byID) != len(rs.order) {
+		answer = append(answer, "(extra index entries)")
+	}
+	return strings.Join(answer, " ")
+}
+
+// countLines gives the number of lines in the file.
+func countLines(t *testing.T, fn string) int {
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); n++ {
+	}
+	return n
+}
+
+func TestReadingStoreLimit(t *testing.T) {
+	tests := []struct {
+		limit, saved int
+		kept         int
+	}{
+		{0, 5, 5},
+		{3, 2, 2},
+		{3, 3, 3},
+		{3, 7, 3},
+		{1, 4, 1},
+	}
+	for _, tt := range tests {
+		rs := &readingStore{limit: tt.limit, byID: make(map[string]*reading)}
+		var saved []string
+		for idx := 0; idx < tt.saved; idx++ {
+			rd := &reading{Layout: "row"}
+			if err := rs.save(rd); err != nil {
+				t.Fatal(err)
+			}
+			saved = append(saved, rd.ID)
+		}
+
+		// the latest are kept, and the rest forgotten
+		if got, want := ids(rs), strings.Join(saved[tt.saved-tt.kept:], " "); got != want {
+			t.Errorf("saving %d, keeping %d, left %s; want %s", tt.saved, tt.limit, got, want)
+		}
+		for idx, id := range saved {
+			if _, ok := rs.lookup(id); ok != (idx >= tt.saved-tt.kept) {
+				t.Errorf("saving %d, keeping %d, looking up reading %d found it %v", tt.saved, tt.limit, idx, ok)
+			}
+		}
+	}
+}
+
+func TestReadingStoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carddiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "readings.jsonl")
+
+	rs := &readingStore{limit: 3, byID: make(map[string]*reading)}
+	if err := rs.open(fn); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		lines int // in the file after each reading is saved
+	}{{1}, {2}, {3}, {4}, {5}, {3}, {4}, {5}, {3}}
+	var saved []string
+	for idx, tt := range tests {
+		rd := &reading{Layout: "row"}
+		if err := rs.save(rd); err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, rd.ID)
+		if got := countLines(t, fn); got != tt.lines || rs.lines != tt.lines {
+			t.Errorf("after saving %d readings, the file has %d lines (counted %d), want %d",
+				idx+1, got, rs.lines, tt.lines)
+		}
+	}
+	rs.file.Close()
+
+	// the readings kept come back after a restart, and a file
+	// that was written without a limit is cut down to size
+	again := &readingStore{limit: 2, byID: make(map[string]*reading)}
+	if err := again.open(fn); err != nil {
+		t.Fatal(err)
+	}
+	defer again.file.Close()
+	if got, want := ids(again), strings.Join(saved[len(saved)-2:], " "); got != want {
+		t.Errorf("reopening the file kept %s, want %s", got, want)
+	}
+	if got := countLines(t, fn); got != 2 {
+		t.Errorf("reopening the file left %d lines, want 2", got)
+	}
+	if _, err := os.Stat(fn + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("rewriting the file left %s.tmp behind", fn)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// a significator is a card the reader picks to stand for the
+// querent, rather than one left to the shuffle.  It is taken out
+// of the deck before shuffling, and put in one position of the
+// spread, such as the center of a Celtic Cross.
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type significator struct {
+	card     int // the card's index in the deck
+	position int // the position's index in the spread
+}
+
+// parseSignificator reads the sig and sigpos parameters.  The card
+// is given by its index in the deck, or by its name, and the position
+// by its number (counting from 1, the default) or its name.  Without
+// a sig parameter, there is no significator.
+func parseSignificator(params url.Values, spr *spread, dk *deck) (*significator, error) {
+	s := strings.TrimSpace(params.Get("sig"))
+	if s == "" {
+		return nil, nil
+	}
+	sig := &significator{card: -1}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n >= dk.NumCards() {
+			return nil, fmt.Errorf("no card %d in the deck", n)
+		}
+		sig.card = n
+	} else {
+		for idx := 0; idx < dk.NumCards(); idx++ {
+			if strings.EqualFold(dk.CardName(idx), s) {
+				sig.card = idx
+				break
+			}
+		}
+		if sig.card < 0 {
+			return nil, fmt.Errorf("no card named %q in the deck", s)
+		}
+	}
+
+	pos := strings.TrimSpace(params.Get("sigpos"))
+	if pos == "" {
+		pos = "1"
+	}
+	if n, err := strconv.Atoi(pos); err == nil {
+		if n < 1 || n > len(spr.Positions) {
+			return nil, fmt.Errorf("bad significator position %q", pos)
+		}
+		sig.position = n - 1
+		return sig, nil
+	}
+	for idx, p := range spr.Positions {
+		if strings.EqualFold(p.Name, pos) {
+			sig.position = idx
+			return sig, nil
+		}
+	}
+	return nil, fmt.Errorf("no position named %q for the significator", pos)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSignificator(t *testing.T) {
+	spr := &spread{Width: 3, Height: 1, Positions: []position{
+		{Name: "Past", X: 0.5, Y: 0.5},
+		{Name: "Present", X: 1.5, Y: 0.5},
+		{Name: "Future", X: 2.5, Y: 0.5},
+	}}
+	dk := testDeck(10)
+
+	tests := []struct {
+		query          string
+		card, position int // -1 for no significator
+		fails          bool
+	}{
+		{"", -1, -1, false},
+		{"sig=", -1, -1, false},
+		{"sig=3", 3, 0, false},
+		{"sig=3&sigpos=", 3, 0, false},
+		{"sig=0&sigpos=3", 0, 2, false},
+		{"sig=card 7&sigpos=present", 7, 1, false},
+		{"sig=Card 9&sigpos=Future", 9, 2, false},
+		{"sig=10", 0, 0, true},
+		{"sig=-1", 0, 0, true},
+		{"sig=Card 99", 0, 0, true},
+		{"sig=3&sigpos=0", 0, 0, true},
+		{"sig=3&sigpos=4", 0, 0, true},
+		{"sig=3&sigpos=Outcome", 0, 0, true},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.query)
+		sig, err := parseSignificator(params, spr, dk)
+		switch {
+		case tt.fails:
+			if err == nil {
+				t.Errorf("parseSignificator(%q) = %+v, want an error", tt.query, sig)
+			}
+		case err != nil:
+			t.Errorf("parseSignificator(%q): %v", tt.query, err)
+		case tt.card < 0:
+			if sig != nil {
+				t.Errorf("parseSignificator(%q) = %+v, want none", tt.query, sig)
+			}
+		case sig == nil || sig.card != tt.card || sig.position != tt.position:
+			t.Errorf("parseSignificator(%q) = %+v, want card %d in position %d",
+				tt.query, sig, tt.card, tt.position)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+// spreads are described by data files rather than code.  Each
+// file gives the size of the layout, and the location of each
+// card, in units of cards.  So, a spread 7 wide and 4 tall has
+// room for 7 upright cards side-by-side, and 4 stacked vertically.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// a position is one place in a spread where a card is drawn.
+// The X and Y coordinates give the center of the card, measured
+// in card widths and card heights respectively.  The rotation is
+// in degrees counter-clockwise, and can be any angle.
+// FaceDown, when given, overrides the spread's choice for this
+// position.
+type position struct {
+	Name     string  `json:"name"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Rotation float64 `json:"rotation,omitempty"`
+	FaceDown *bool   `json:"faceDown,omitempty"`
+}
+
+// a spread is a complete layout of cards, as loaded from a
+// data file.
+type spread struct {
+	Display   string     `json:"display"`
+	Deck      string     `json:"deck,omitempty"`
+	Width     float64    `json:"width"`
+	Height    float64    `json:"height"`
+	FaceDown  bool       `json:"faceDown,omitempty"`
+	Positions []position `json:"positions"`
+
+	// a spread laid out in card widths both across and down keeps
+	// its shape by widening the gutter between rows in proportion
+	// to the cards' height
+	proportional bool
+}
+
+// a deckShape tells a layout what it needs to know about the deck:
+// the aspect ratio (width / height) of its cards, for layouts whose
+// shape has to hold in pixels, such as circles; and how many cards
+// it has, for layouts that use all of them.
+type deckShape struct {
+	ratio float64
+	cards int
+}
+
+func (dk *deck) shape() deckShape { return deckShape{dk.Ratio(), dk.NumCards()} }
+
+// a layout knows how to produce a spread, possibly depending
+// on the parameters of the request and the shape of the deck.
+type layout interface {
+	Spread(params url.Values, ds deckShape) (*spread, error)
+}
+
+// a fixed spread from a data file doesn't depend on the request.
+func (s *spread) Spread(params url.Values, ds deckShape) (*spread, error) { return s, nil }
+
+// layoutFunc adapts a generator function to the layout interface.
+type layoutFunc func(params url.Values, ds deckShape) (*spread, error)
+
+func (lf layoutFunc) Spread(params url.Values, ds deckShape) (*spread, error) {
+	return lf(params, ds)
+}
+
+// a deckedLayout is a generated layout that names the deck to use
+// when the request doesn't, as a spread file can.
+type deckedLayout struct {
+	layoutFunc
+	deck string
+}
+
+// layouts holds every registered layout, by name.
+var layouts = make(map[string]layout)
+
+// registerLayout adds a layout to the server, and describes it
+// to the UI.  A layout replacing another of the same name takes
+// over its description, too.
+func registerLayout(name string, display string, params []string, l layout) {
+	cfg := cardConfig{"/carddiv/" + name + "/", display, params, positionNames(l)}
+	if _, ok := layouts[name]; ok {
+		for idx := range configurations {
+			if configurations[idx].ID == cfg.ID {
+				configurations[idx] = cfg
+			}
+		}
+	} else {
+		configurations = append(configurations, cfg)
+	}
+	layouts[name] = l
+}
+
+// positionNames gives the names of a layout's positions, for
+// layouts where they are known before the request comes in.
+func positionNames(l layout) []string {
+	switch l := l.(type) {
+	case *spread:
+		names := make([]string, len(l.Positions))
+		for idx, p := range l.Positions {
+			names[idx] = p.Name
+		}
+		return names
+	case wheelPreset:
+		return l.positionNames()
+	}
+	return nil
+}
+
+func (s *spread) validate() error {
+	if s.Width <= 0 || s.Height <= 0 {
+		return fmt.Errorf("spread has invalid size %gx%g", s.Width, s.Height)
+	}
+	if len(s.Positions) == 0 {
+		return fmt.Errorf("spread has no positions")
+	}
+	return nil
+}
+
+// loadSpread reads a single spread definition file.
+func loadSpread(fn string) (*spread, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s spread
+	if err = json.NewDecoder(f).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	if err = s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return &s, nil
+}
+
+// loadSpreads registers every *.json spread in the given
+// directory, named after the file.  Spreads loaded later
+// replace any earlier spread of the same name.
+func loadSpreads(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, fn := range files {
+		s, err := loadSpread(fn)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+		if s.Display == "" {
+			s.Display = name
+		}
+		registerLayout(name, s.Display, []string{}, s)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+// decks can be stored as zip files, tar files, or plain
+// directories of images.  A cardStore hides the difference,
+// presenting the files of the deck in a fixed order: as they
+// are stored in an archive, or sorted by path in a directory.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// a storeFile is a single file in a card store.  Its name is
+// the path within the store, separated by slashes.
+type storeFile interface {
+	Name() string
+	Open() (io.ReadCloser, error)
+}
+
+type cardStore interface {
+	Files() []storeFile
+	Close() error
+}
+
+// openStore opens the deck storage at fn, deciding the kind of
+// store from the file.
+func openStore(fn string) (cardStore, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case fi.IsDir():
+		return openDirStore(fn)
+	case strings.ToLower(filepath.Ext(fn)) == ".tar":
+		return openTarStore(fn)
+	}
+	return openZipStore(fn)
+}
+
+// ------------------------------------------------------------
+// zip files
+
+type zipStore struct {
+	zfile *zip.ReadCloser
+	files []storeFile
+}
+
+type zipEntry struct {
+	*zip.File
+}
+
+func (ze zipEntry) Name() string { return ze.File.Name }
+
+func openZipStore(fn string) (*zipStore, error) {
+	zfile, err := zip.OpenReader(fn)
+	if err != nil {
+		return nil, err
+	}
+	zs := &zipStore{zfile: zfile}
+	for _, v := range zfile.File {
+		if v.FileInfo().Mode().IsRegular() {
+			zs.files = append(zs.files, zipEntry{v})
+		}
+	}
+	return zs, nil
+}
+
+func (zs *zipStore) Files() []storeFile { return zs.files }
+func (zs *zipStore) Close() error       { return zs.zfile.Close() }
+
+// ------------------------------------------------------------
+// directories
+
+type dirStore struct {
+	files []storeFile
+}
+
+type dirEntry struct {
+	root string
+	name string
+}
+
+func (de dirEntry) Name() string { return de.name }
+func (de dirEntry) Open() (io.ReadCloser, error) {
+	return os.Open(filepath.Join(de.root, filepath.FromSlash(de.name)))
+}
+
+// maxDirDepth is how many levels of subdirectories a directory
+// deck can have, such as one for the major arcana and one for each
+// suit of the minor.
+const maxDirDepth = 2
+
+// openDirStore collects every regular file under the directory,
+// skipping hidden files and directories, and anything nested more
+// than maxDirDepth directories down.
+func openDirStore(root string) (*dirStore, error) {
+	ds := &dirStore{}
+	err := filepath.Walk(root, func(fn string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fn != root && strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() && fn != root {
+			rel, err := filepath.Rel(root, fn)
+			if err != nil {
+				return err
+			}
+			if strings.Count(filepath.ToSlash(rel), "/") >= maxDirDepth {
+				return filepath.SkipDir
+			}
+		}
+		if fi.Mode().IsRegular() {
+			rel, err := filepath.Rel(root, fn)
+			if err != nil {
+				return err
+			}
+			ds.files = append(ds.files, dirEntry{root, filepath.ToSlash(rel)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+func (ds *dirStore) Files() []storeFile { return ds.files }
+func (ds *dirStore) Close() error       { return nil }
+
+// ------------------------------------------------------------
+// tar files (uncompressed, so that we can seek to each card)
+
+type tarStore struct {
+	file  *os.File
+	files []storeFile
+}
+
+type tarEntry struct {
+	file   *os.File
+	name   string
+	offset int64
+	size   int64
+}
+
+func (te tarEntry) Name() string { return te.name }
+func (te tarEntry) Open() (io.ReadCloser, error) {
+	return io.NopCloser(io.NewSectionReader(te.file, te.offset, te.size)), nil
+}
+
+// openTarStore reads through the headers of the tar file, noting
+// where each file's contents start.
+func openTarStore(fn string) (*tarStore, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	ts := &tarStore{file: f}
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// the tar reader leaves the file positioned at the contents
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		ts.files = append(ts.files, tarEntry{f, path.Clean(hdr.Name), offset, hdr.Size})
+	}
+	return ts, nil
+}
+
+func (ts *tarStore) Files() []storeFile { return ts.files }
+func (ts *tarStore) Close() error       { return ts.file.Close() }
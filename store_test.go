@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTarStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carddiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []struct {
+		name, body string
+		dir        bool
+	}{
+		{"deck/", "", true},
+		{"deck/./one.png", "first card", false},
+		{"deck/two.png", "the second card", false},
+		{"deck/deck.json", "{}", false},
+	}
+	fn := filepath.Join(dir, "deck.tar")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.body)), Typeflag: tar.TypeReg}
+		if file.dir {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(file.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	ts, err := openTarStore(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	want := []struct{ name, body string }{
+		{"deck/one.png", "first card"},
+		{"deck/two.png", "the second card"},
+		{"deck/deck.json", "{}"},
+	}
+	if len(ts.Files()) != len(want) {
+		t.Fatalf("tar store has %d files, want %d", len(ts.Files()), len(want))
+	}
+	// read them out of order, to be sure each seeks to its own place
+	for idx := len(want) - 1; idx >= 0; idx-- {
+		sf := ts.Files()[idx]
+		if sf.Name() != want[idx].name {
+			t.Errorf("file %d is named %q, want %q", idx, sf.Name(), want[idx].name)
+		}
+		rdr, err := sf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(rdr)
+		rdr.Close()
+		if err != nil || string(body) != want[idx].body {
+			t.Errorf("%s holds %q (%v), want %q", sf.Name(), body, err, want[idx].body)
+		}
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carddiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"b.png",
+		"a.png",
+		".hidden.png",
+		".git/c.png",
+		"minor/wands/d.png",
+		"minor/wands/deeper/e.png",
+	} {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fn, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ds, err := openDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sf := range ds.Files() {
+		names = append(names, sf.Name())
+	}
+	if got, want := strings.Join(names, " "), "a.png b.png minor/wands/d.png"; got != want {
+		t.Errorf("directory store has %q, want %q", got, want)
+	}
+}
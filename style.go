@@ -0,0 +1,230 @@
+package main
+
+// cards can be drawn with a border, rounded corners, and a soft
+// shadow beneath them, so that overlapping cards stand apart
+// like real ones on a table.  All of the sizes are in pixels.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"net/url"
+)
+
+type cardStyle struct {
+	border      int // width of the border
+	borderColor color.Color
+	radius      int // radius of the corners
+	shadow      int // how far the shadow spreads
+}
+
+var shadowColor = color.NRGBA{0, 0, 0, 0x90}
+
+func newCardStyle(params url.Values) (cardStyle, error) {
+	var cs cardStyle
+	var err error
+	if cs.border, err = pixelParam(params, "border"); err != nil {
+		return cs, err
+	}
+	if cs.radius, err = pixelParam(params, "corners"); err != nil {
+		return cs, err
+	}
+	if cs.shadow, err = pixelParam(params, "shadow"); err != nil {
+		return cs, err
+	}
+	cs.borderColor = color.Black
+	if s := params.Get("bordercolor"); s != "" {
+		if cs.borderColor, err = parseColor(s); err != nil {
+			return cs, fmt.Errorf("bad border color %q", s)
+		}
+	}
+	return cs, nil
+}
+
+// drawCard draws the card into the rectangle, styled.
+func (cs cardStyle) drawCard(dst draw.Image, r image.Rectangle, card image.Image) {
+	if cs.shadowSpread(r.Size()) > 0 {
+		cs.drawShadow(dst, r, roundedMask(r.Size(), cs.cornerRadius(r.Size())))
+	}
+	cs.drawFace(dst, r, card)
+}
+
+// drawTilted draws the card tilted by the angle, centered in the
+// rectangle.  The card is styled before it is turned, so that the
+// border and corners turn with it.
+func (cs cardStyle) drawTilted(dst draw.Image, r image.Rectangle, card image.Image, degrees float64) {
+	face := image.NewRGBA(image.Rectangle{image.ZP, card.Bounds().Size()})
+	cs.drawFace(face, face.Bounds(), card)
+	tilted := tiltImage(face, degrees)
+
+	at := r.Min.Add(r.Size().Sub(tilted.Bounds().Size()).Div(2))
+	tr := tilted.Bounds().Add(at)
+	if cs.shadowSpread(tr.Size()) > 0 {
+		shape := image.NewAlpha(tilted.Bounds())
+		draw.Draw(shape, shape.Bounds(), tilted, image.ZP, draw.Src)
+		cs.drawShadow(dst, tr, shape)
+	}
+	draw.Draw(dst, tr, tilted, image.ZP, draw.Over)
+}
+
+// cornerRadius gives the radius of the corners for a card of
+// the given size, which can't be more than half of either side.
+func (cs cardStyle) cornerRadius(size image.Point) int {
+	radius := cs.radius
+	if radius > size.X/2 {
+		radius = size.X / 2
+	}
+	if radius > size.Y/2 {
+		radius = size.Y / 2
+	}
+	return radius
+}
+
+// borderWidth gives the width of the border for a card of the
+// given size, which can't be more than half of either side.
+func (cs cardStyle) borderWidth(size image.Point) int {
+	border := cs.border
+	if border > size.X/2 {
+		border = size.X / 2
+	}
+	if border > size.Y/2 {
+		border = size.Y / 2
+	}
+	return border
+}
+
+// shadowSpread gives how far the shadow spreads for a card of
+// the given size, which can't be more than a quarter of either
+// side.
+func (cs cardStyle) shadowSpread(size image.Point) int {
+	shadow := cs.shadow
+	if shadow > size.X/4 {
+		shadow = size.X / 4
+	}
+	if shadow > size.Y/4 {
+		shadow = size.Y / 4
+	}
+	return shadow
+}
+
+// drawShadow blurs the shape of a card at r, and drops it
+// down and to the right.
+func (cs cardStyle) drawShadow(dst draw.Image, r image.Rectangle, shape *image.Alpha) {
+	size := r.Size()
+	shadow := cs.shadowSpread(size)
+	pad := shadow * 2
+	padded := image.NewAlpha(image.Rectangle{image.ZP, size.Add(image.Pt(2*pad, 2*pad))})
+	draw.Draw(padded, image.Rectangle{image.Pt(pad, pad), size.Add(image.Pt(pad, pad))},
+		shape, shape.Bounds().Min, draw.Src)
+	blurred := blurAlpha(blurAlpha(padded, shadow/2), shadow/2)
+	at := r.Min.Sub(image.Pt(pad, pad)).Add(image.Pt(shadow/2, shadow/2))
+	draw.DrawMask(dst, blurred.Bounds().Add(at), &image.Uniform{shadowColor}, image.ZP,
+		blurred, image.ZP, draw.Over)
+}
+
+// drawFace draws the card with its corners and border.
+func (cs cardStyle) drawFace(dst draw.Image, r image.Rectangle, card image.Image) {
+	size := r.Size()
+	radius := cs.cornerRadius(size)
+	if radius > 0 {
+		draw.DrawMask(dst, r, card, card.Bounds().Min, roundedMask(size, radius), image.ZP, draw.Over)
+	} else {
+		draw.Draw(dst, r, card, card.Bounds().Min, draw.Over)
+	}
+
+	if border := cs.borderWidth(size); border > 0 {
+		draw.DrawMask(dst, r, &image.Uniform{cs.borderColor}, image.ZP,
+			ringMask(size, radius, border), image.ZP, draw.Over)
+	}
+}
+
+// roundedMask covers a rectangle of the given size, with its
+// corners rounded to the radius.  The edges of the corners are
+// smoothed.
+func roundedMask(size image.Point, radius int) *image.Alpha {
+	mask := image.NewAlpha(image.Rectangle{image.ZP, size})
+	draw.Draw(mask, mask.Bounds(), image.Opaque, image.ZP, draw.Src)
+	if radius <= 0 {
+		return mask
+	}
+
+	rf := float64(radius)
+	for y := 0; y < radius && y < size.Y; y++ {
+		for x := 0; x < radius && x < size.X; x++ {
+			// distance from the center of the corner's circle
+			d := math.Hypot(rf-float64(x)-0.5, rf-float64(y)-0.5)
+			a := color.Alpha{uint8(255 * math.Max(0, math.Min(1, rf-d+0.5)))}
+			mask.SetAlpha(x, y, a)
+			mask.SetAlpha(size.X-1-x, y, a)
+			mask.SetAlpha(x, size.Y-1-y, a)
+			mask.SetAlpha(size.X-1-x, size.Y-1-y, a)
+		}
+	}
+	return mask
+}
+
+// ringMask covers the band of the given width just inside the
+// edge of a rounded rectangle.
+func ringMask(size image.Point, radius, width int) *image.Alpha {
+	ring := roundedMask(size, radius)
+	inner := size.Sub(image.Pt(2*width, 2*width))
+	if inner.X <= 0 || inner.Y <= 0 {
+		return ring
+	}
+	hole := roundedMask(inner, radius-width)
+	for y := 0; y < inner.Y; y++ {
+		for x := 0; x < inner.X; x++ {
+			o := ring.AlphaAt(x+width, y+width).A
+			h := hole.AlphaAt(x, y).A
+			ring.SetAlpha(x+width, y+width, color.Alpha{uint8(int(o) * (255 - int(h)) / 255)})
+		}
+	}
+	return ring
+}
+
+// blurAlpha spreads the mask out with a box blur of the given
+// radius, across and then down.  Each pass keeps a running sum
+// over the box as it slides along, so the radius doesn't slow
+// it down.
+func blurAlpha(src *image.Alpha, radius int) *image.Alpha {
+	if radius < 1 {
+		return src
+	}
+	b := src.Bounds()
+	box := 2*radius + 1
+	across := image.NewAlpha(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		sum := 0
+		for i := b.Min.X; i < b.Min.X+radius && i < b.Max.X; i++ {
+			sum += int(src.AlphaAt(i, y).A)
+		}
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if i := x + radius; i < b.Max.X {
+				sum += int(src.AlphaAt(i, y).A)
+			}
+			if i := x - radius - 1; i >= b.Min.X {
+				sum -= int(src.AlphaAt(i, y).A)
+			}
+			across.SetAlpha(x, y, color.Alpha{uint8(sum / box)})
+		}
+	}
+	down := image.NewAlpha(b)
+	for x := b.Min.X; x < b.Max.X; x++ {
+		sum := 0
+		for j := b.Min.Y; j < b.Min.Y+radius && j < b.Max.Y; j++ {
+			sum += int(across.AlphaAt(x, j).A)
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if j := y + radius; j < b.Max.Y {
+				sum += int(across.AlphaAt(x, j).A)
+			}
+			if j := y - radius - 1; j >= b.Min.Y {
+				sum -= int(across.AlphaAt(x, j).A)
+			}
+			down.SetAlpha(x, y, color.Alpha{uint8(sum / box)})
+		}
+	}
+	return down
+}
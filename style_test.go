@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestStyleLimits(t *testing.T) {
+	cs := cardStyle{border: 3000, radius: 3000, shadow: 3000}
+	small := cardStyle{border: 2, radius: 5, shadow: 4}
+	tests := []struct {
+		style                  cardStyle
+		size                   image.Point
+		border, radius, shadow int
+	}{
+		{cs, image.Pt(140, 200), 70, 70, 35},
+		{cs, image.Pt(200, 140), 70, 70, 35},
+		{cs, image.Pt(1, 1), 0, 0, 0},
+		{small, image.Pt(140, 200), 2, 5, 4},
+		{small, image.Pt(12, 200), 2, 5, 3},
+	}
+	for _, tt := range tests {
+		if got := tt.style.borderWidth(tt.size); got != tt.border {
+			t.Errorf("border %d on a %v card = %d, want %d", tt.style.border, tt.size, got, tt.border)
+		}
+		if got := tt.style.cornerRadius(tt.size); got != tt.radius {
+			t.Errorf("corners %d on a %v card = %d, want %d", tt.style.radius, tt.size, got, tt.radius)
+		}
+		if got := tt.style.shadowSpread(tt.size); got != tt.shadow {
+			t.Errorf("shadow %d on a %v card = %d, want %d", tt.style.shadow, tt.size, got, tt.shadow)
+		}
+	}
+}
+
+// boxBlur is blurAlpha done the slow way, summing every box.
+func boxBlur(src *image.Alpha, radius int) *image.Alpha {
+	b := src.Bounds()
+	across := image.NewAlpha(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sum := 0
+			for i := x - radius; i <= x+radius; i++ {
+				if i >= b.Min.X && i < b.Max.X {
+					sum += int(src.AlphaAt(i, y).A)
+				}
+			}
+			across.SetAlpha(x, y, color.Alpha{uint8(sum / (2*radius + 1))})
+		}
+	}
+	down := image.NewAlpha(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sum := 0
+			for j := y - radius; j <= y+radius; j++ {
+				if j >= b.Min.Y && j < b.Max.Y {
+					sum += int(across.AlphaAt(x, j).A)
+				}
+			}
+			down.SetAlpha(x, y, color.Alpha{uint8(sum / (2*radius + 1))})
+		}
+	}
+	return down
+}
+
+func TestBlurAlpha(t *testing.T) {
+	src := image.NewAlpha(image.Rect(3, 5, 40, 27))
+	for y := 5; y < 27; y++ {
+		for x := 3; x < 40; x++ {
+			src.SetAlpha(x, y, color.Alpha{uint8((x*37 + y*101) % 256)})
+		}
+	}
+	for _, radius := range []int{1, 2, 5, 21, 50} {
+		got, want := blurAlpha(src, radius), boxBlur(src, radius)
+		if got.Bounds() != want.Bounds() {
+			t.Fatalf("radius %d blurred into %v, want %v", radius, got.Bounds(), want.Bounds())
+		}
+		for y := 5; y < 27; y++ {
+			for x := 3; x < 40; x++ {
+				if g, w := got.AlphaAt(x, y), want.AlphaAt(x, y); g != w {
+					t.Fatalf("radius %d gave %d at %d,%d, want %d", radius, g.A, x, y, w.A)
+				}
+			}
+		}
+	}
+}